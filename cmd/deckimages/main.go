@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/archetype"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/config"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/deckimage"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/deckrecipe"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/failure"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/importrun"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/deadletter"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/deck"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/imagestore"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/postgres"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/mackerel"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/metrics"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/worker"
+)
+
+const (
+	// アップロードの再試行の初回の待ち時間
+	initialInterval = 500 * time.Millisecond
+
+	// 画像の取得先への負荷を抑えるため dequeue より少なくする
+	defaultConcurrency = 10
+	// 1回の配信の中でアップロードを再試行する回数
+	defaultUploadRetries = 3
+
+	// SimpleMQ の可視性タイムアウト (30秒) より十分短くする
+	defaultHeartbeatInterval = 10 * time.Second
+
+	defaultMaxAttempts = 10
+
+	// 1件でもエラーがあれば異常終了する
+	defaultMaxErrors = 0
+
+	// systemd の TimeoutStopSec (90秒) より短くする
+	defaultShutdownTimeout = 60 * time.Second
+)
+
+// 失敗した場合は指数バックオフで retries 回まで再試行する
+func uploadWithRetry(ctx context.Context, pipeline *deckimage.Pipeline, deckCode string, retries int) (int, error) {
+	interval := initialInterval
+
+	for attempt := 0; ; attempt++ {
+		n, err := pipeline.Upload(ctx, deckCode)
+		if err == nil || attempt == retries || ctx.Err() != nil {
+			return n, err
+		}
+
+		slog.Warn("Upload deck images failed, retrying", logging.KeyDeckCode, deckCode, logging.KeyStage, metrics.StageUploadImages, "attempt", attempt, "max_retries", retries, "retry_in", interval, logging.Err(err))
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
+
+// dequeue が送ったデッキ画像のアップロード依頼を処理する
+func main() {
+	if err := godotenv.Load(); err != nil {
+		slog.Error("Failed to load .env file", logging.Err(err))
+		os.Exit(1)
+	}
+
+	cfg := config.FromEnv()
+	cfg.DeckImageMQ.RegisterFlags(flag.CommandLine)
+	cfg.DB.RegisterFlags(flag.CommandLine)
+	cfg.Storage.RegisterFlags(flag.CommandLine)
+	cfg.API.RegisterResultsFlags(flag.CommandLine)
+	cfg.DeckImage.RegisterFlags(flag.CommandLine)
+	cfg.Archetype.RegisterFlags(flag.CommandLine)
+	cfg.Metrics.RegisterFlags(flag.CommandLine)
+	cfg.Mackerel.RegisterFlags(flag.CommandLine)
+	cfg.Log.RegisterFlags(flag.CommandLine)
+
+	decksDir := flag.String("decks-dir", "", "read deck recipes from saved deck pages in this directory instead of the official site")
+	concurrency := flag.Int("concurrency", defaultConcurrency, "number of decks processed at the same time")
+	uploadRetries := flag.Int("upload-retries", defaultUploadRetries, "number of times a failed upload is retried before the message is left for redelivery")
+	maxAttempts := flag.Uint("max-attempts", defaultMaxAttempts, "number of failed deliveries after which a message is moved to dead letters")
+	maxErrors := flag.Int("max-errors", defaultMaxErrors, "number of errors tolerated before the run exits with a non-zero status")
+	shutdownTimeout := flag.Duration("shutdown-timeout", defaultShutdownTimeout, "how long in-flight decks may keep running after SIGTERM before they are abandoned for redelivery")
+	heartbeatInterval := flag.Duration("heartbeat-interval", defaultHeartbeatInterval, "how often to extend the visibility timeout of messages being processed")
+	flag.Parse()
+
+	if err := logging.Setup(cfg.Log.Format, cfg.Log.Level); err != nil {
+		slog.Error("Invalid log configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	if err := errors.Join(cfg.DeckImageMQ.Validate(), cfg.DB.Validate(), cfg.Storage.Validate(), cfg.API.ValidateResults(), cfg.Metrics.Validate(), cfg.Mackerel.Validate()); err != nil {
+		slog.Error("Invalid configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	renditions, err := deckimage.ParseRenditions(cfg.DeckImage.Renditions)
+	if err != nil {
+		slog.Error("Invalid deck image renditions", logging.Err(err))
+		os.Exit(1)
+	}
+
+	if *concurrency <= 0 {
+		slog.Error("Invalid -concurrency", "concurrency", *concurrency)
+		os.Exit(1)
+	}
+
+	if *uploadRetries < 0 {
+		slog.Error("Invalid -upload-retries", "upload_retries", *uploadRetries)
+		os.Exit(1)
+	}
+
+	if *heartbeatInterval <= 0 {
+		slog.Error("Invalid -heartbeat-interval", "heartbeat_interval", *heartbeatInterval)
+		os.Exit(1)
+	}
+
+	if *maxAttempts == 0 {
+		slog.Error("Invalid -max-attempts", "max_attempts", *maxAttempts)
+		os.Exit(1)
+	}
+
+	if *maxErrors < 0 {
+		slog.Error("Invalid -max-errors", "max_errors", *maxErrors)
+		os.Exit(1)
+	}
+
+	db, err := postgres.NewDB(cfg.DB.Hostname, cfg.DB.Port, cfg.DB.UserName, cfg.DB.UserPassword, cfg.DB.Name)
+	if err != nil {
+		slog.Error("Failed to connect database", logging.Err(err))
+		os.Exit(1)
+	}
+
+	var store imagestore.ImageStore
+	switch cfg.Storage.Backend {
+	case config.StorageBackendLocal:
+		store = imagestore.NewLocalImageStore(cfg.Storage.LocalDir)
+	default:
+		store, err = imagestore.NewS3ImageStore(context.Background(), cfg.Storage.Endpoint, cfg.Storage.Bucket)
+		if err != nil {
+			slog.Error("Failed to load default aws config", logging.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	var mqc simplemq.SimpleMQ
+	if cfg.DeckImageMQ.File != "" {
+		mqc = simplemq.NewFileMQ(cfg.DeckImageMQ.File, simplemq.DefaultVisibilityTimeout, simplemq.DefaultRetentionPeriod)
+	} else {
+		mqc = simplemq.NewSimpleMQClientWithBaseURL(cfg.DeckImageMQ.BaseURL, cfg.DeckImageMQ.Name, cfg.DeckImageMQ.Token)
+	}
+
+	var ds deck.DeckSource
+	if *decksDir != "" {
+		ds = deck.NewFileDeckSource(*decksDir)
+	} else {
+		ds = deck.NewHTTPDeckSource(cfg.API.DeckBaseURL)
+	}
+
+	var classifier *archetype.Classifier
+	if cfg.Archetype.RulesFile != "" {
+		classifier, err = archetype.LoadClassifier(cfg.Archetype.RulesFile)
+		if err != nil {
+			slog.Error("Failed to load archetype rules", logging.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	deckRepo := postgres.NewDeckRepository(db)
+	resultRepo := postgres.NewResultRepository(db)
+	pipeline := deckimage.NewPipeline(store, postgres.NewDeckImageRepository(db), cfg.API.DeckBaseURL, renditions, cfg.DeckImage.CacheControl)
+	tracker := deadletter.NewTracker(db, deadletter.QueueDeckImages, *maxAttempts)
+	m := metrics.New("deckimages")
+	agg := failure.NewAggregator(*maxErrors)
+	sink, err := mackerel.NewSink(cfg.Mackerel.Sink, cfg.Mackerel.File, cfg.Mackerel.BaseURL, cfg.Mackerel.APIKey)
+	if err != nil {
+		slog.Error("Invalid Mackerel sink", logging.Err(err))
+		os.Exit(1)
+	}
+	reporter := mackerel.NewReporter(sink, cfg.Mackerel.Service, "import-cityleague-result-job.deckimages")
+
+	// 実行ごとの処理件数とエラーを import_runs に記録する
+	ledger, err := importrun.Start(context.Background(), postgres.NewImportRunRepository(db), "deckimages")
+	if err != nil {
+		slog.Error("Failed to record start of import run", logging.Err(err))
+		os.Exit(1)
+	}
+	slog.Info("Import run started", logging.KeyRunID, ledger.ID())
+
+	// シグナルを受け取ったら新しいメッセージの受信をやめる
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var mu sync.Mutex
+	uploaded := 0
+
+	w := worker.NewWorker(mqc, tracker, m, agg, ledger, *concurrency, *heartbeatInterval, *shutdownTimeout)
+	w.Run(ctx, func(ctx context.Context, msg *simplemq.Message) error {
+		// 壊れたメッセージは何度受信しても処理できないので、すぐに dead letter に移す
+		job, err := deckimage.DecodeJob(msg.Content)
+		if err != nil {
+			return &worker.Error{
+				Category: metrics.CategoryDecode,
+				Message:  "Invalid deck image job",
+				Err:      err,
+				Discard:  true,
+			}
+		}
+
+		logger := slog.With(logging.KeyMsgID, msg.ID, logging.KeyDeckCode, job.DeckCode)
+		attrs := []any{logging.KeyDeckCode, job.DeckCode}
+
+		// カード構成の取得に失敗しても画像のアップロードは続け、最後に失敗として再配信に任せる
+		done := m.Time(metrics.StageDeckRecipe)
+		recipeErr := deckrecipe.Import(ctx, ds, deckRepo, job.DeckCode)
+		done()
+
+		done = m.Time(metrics.StageUploadImages)
+		n, err := uploadWithRetry(ctx, pipeline, job.DeckCode, *uploadRetries)
+		done()
+		if err != nil {
+			return &worker.Error{
+				Category: metrics.CategoryUploadImages,
+				Message:  "Failed to upload deck images",
+				Err:      err,
+				Attrs:    attrs,
+			}
+		}
+
+		m.ImagesUploaded.Add(float64(n))
+		ledger.ImagesUploaded(n)
+		logger.Debug("Deck images uploaded", logging.KeyStage, metrics.StageUploadImages, "uploaded", n)
+		mu.Lock()
+		uploaded += n
+		mu.Unlock()
+
+		if recipeErr != nil {
+			return &worker.Error{
+				Category: metrics.CategoryDeckRecipe,
+				Message:  "Failed to import deck recipe",
+				Err:      recipeErr,
+				Attrs:    attrs,
+			}
+		}
+
+		// 取り込み時にカード構成がなく判定できなかった成績のアーキタイプを判定する
+		if err := deckrecipe.Classify(ctx, classifier, deckRepo, resultRepo, job.DeckCode); err != nil {
+			return &worker.Error{
+				Category: metrics.CategoryClassify,
+				Message:  "Failed to classify deck",
+				Err:      err,
+				Attrs:    attrs,
+			}
+		}
+
+		return nil
+	})
+
+	if err := ledger.Finish(context.Background(), ctx.Err() != nil); err != nil {
+		slog.Error("Failed to record end of import run", logging.KeyRunID, ledger.ID(), logging.Err(err))
+	}
+
+	// エラーが閾値を超えた場合は systemd や mkr wrap が失敗を検知できるように異常終了する
+	exitCode := agg.ExitCode()
+
+	m.Finish(exitCode == 0)
+	if err := m.Export(context.Background(), cfg.Metrics.TextfileDir, cfg.Metrics.PushURL); err != nil {
+		slog.Error("Failed to export metrics", logging.Err(err))
+	}
+
+	if err := reporter.Report(context.Background(), m); err != nil {
+		slog.Error("Failed to report metrics to Mackerel", logging.Err(err))
+	}
+
+	if ctx.Err() != nil {
+		slog.Info("Shutdown completed")
+	}
+
+	attrs := append([]any{"uploaded", uploaded}, agg.Attrs()...)
+	switch {
+	case exitCode != 0:
+		slog.Error("Deck images job failed, too many errors", attrs...)
+	case agg.Total() > 0:
+		slog.Warn("Deck images job completed with errors", attrs...)
+	default:
+		slog.Info("Deck images job completed", attrs...)
+	}
+
+	os.Exit(exitCode)
+}
@@ -1,423 +1,262 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
-	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
-	"io"
-	"log"
-	"net/http"
+	"flag"
+	"log/slog"
 	"os"
-	"sync"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	awsConfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/joho/godotenv"
-	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/archetype"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/config"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/failure"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/importer"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/importrun"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/deadletter"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/eventresult"
 	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/postgres"
 	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/mackerel"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/metrics"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/worker"
 )
 
 const (
-	errorMaxNum       = 50
 	concurrencyMaxNum = 100
 
-	maxRetries      = 5
-	initialInterval = 500 * time.Millisecond
-)
+	// SimpleMQ の可視性タイムアウト (30秒) より十分短くする
+	defaultHeartbeatInterval = 10 * time.Second
 
-type OfficialEvent struct {
-	ID              uint      `json:"id"`
-	Title           string    `json:"title"`
-	Address         string    `json:"address"`
-	Venue           string    `json:"venue"`
-	Date            time.Time `json:"date"`
-	StartedAt       time.Time `json:"started_at"`
-	EndedAt         time.Time `json:"ended_at"`
-	TypeName        string    `json:"type_name"`
-	LeagueTitle     string    `json:"league_title"`
-	RegulationTitle string    `json:"regulation_title"`
-	CSPFlg          bool      `json:"csp_flg"`
-	Capacity        uint      `json:"capacity"`
-	ShopId          uint      `json:"shop_id"`
-	ShopName        string    `json:"shop_name"`
-}
+	defaultMaxAttempts = 10
 
-type OfficialEventGetResponse struct {
-	TypeId         uint             `json:"type_id"`
-	LeagueType     uint             `json:"league_type"`
-	StartDate      time.Time        `json:"start_date"`
-	EndDate        time.Time        `json:"end_date"`
-	OfficialEvents []*OfficialEvent `json:"official_events"`
-}
-
-type EventResultDetailSearch struct {
-	Code    uint           `json:"code"`
-	Count   uint           `json:"count"`
-	Results []*EventResult `json:"results"`
-}
+	// 1件でもエラーがあれば異常終了する
+	defaultMaxErrors = 0
 
-type EventResult struct {
-	PlayerId string `json:"player_id"`
-	Name     string `json:"name"`
-	Rank     uint   `json:"rank"`
-	Point    uint   `json:"point"`
-	DeckId   string `json:"deck_id"`
-}
+	// systemd の TimeoutStopSec (90秒) より短くする
+	defaultShutdownTimeout = 60 * time.Second
+)
 
-func getEventResults(eventId uint) ([]*EventResult, error) {
-	res, err := http.Get(fmt.Sprintf(
-		"https://players.pokemon-card.com/event_result_detail_search?event_holding_id=%d",
-		eventId),
-	)
-	if err != nil {
-		return nil, err
+func main() {
+	if err := godotenv.Load(); err != nil {
+		slog.Error("Failed to load .env file", logging.Err(err))
+		os.Exit(1)
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode == http.StatusNotFound {
-		return []*EventResult{}, nil
+	cfg := config.FromEnv()
+	cfg.MQ.RegisterFlags(flag.CommandLine)
+	cfg.DB.RegisterFlags(flag.CommandLine)
+	cfg.DeckImageMQ.RegisterFlags(flag.CommandLine)
+	cfg.API.RegisterResultsFlags(flag.CommandLine)
+	cfg.Archetype.RegisterFlags(flag.CommandLine)
+	cfg.Metrics.RegisterFlags(flag.CommandLine)
+	cfg.Mackerel.RegisterFlags(flag.CommandLine)
+	cfg.Log.RegisterFlags(flag.CommandLine)
+
+	resultsDir := flag.String("results-dir", "", "read event results from recorded JSON files in this directory instead of the official site")
+	maxAttempts := flag.Uint("max-attempts", defaultMaxAttempts, "number of failed deliveries after which a message is moved to dead letters")
+	maxErrors := flag.Int("max-errors", defaultMaxErrors, "number of errors tolerated before the run exits with a non-zero status")
+	shutdownTimeout := flag.Duration("shutdown-timeout", defaultShutdownTimeout, "how long in-flight events may keep running after SIGTERM before they are abandoned for redelivery")
+	heartbeatInterval := flag.Duration("heartbeat-interval", defaultHeartbeatInterval, "how often to extend the visibility timeout of messages being processed")
+	flag.Parse()
+
+	if err := logging.Setup(cfg.Log.Format, cfg.Log.Level); err != nil {
+		slog.Error("Invalid log configuration", logging.Err(err))
+		os.Exit(1)
 	}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
+	if err := errors.Join(cfg.MQ.Validate(), cfg.DeckImageMQ.Validate(), cfg.DB.Validate(), cfg.API.ValidateResults(), cfg.Metrics.Validate(), cfg.Mackerel.Validate()); err != nil {
+		slog.Error("Invalid configuration", logging.Err(err))
+		os.Exit(1)
 	}
 
-	var eds EventResultDetailSearch
-	if err := json.Unmarshal(body, &eds); err != nil {
-		return nil, err
+	if *heartbeatInterval <= 0 {
+		slog.Error("Invalid -heartbeat-interval", "heartbeat_interval", *heartbeatInterval)
+		os.Exit(1)
 	}
 
-	return eds.Results, nil
-}
-
-func receiveMessageWithRetry(ctx context.Context, mqc simplemq.SimpleMQ) (*simplemq.ReceiveMessageResponse, error) {
-	interval := initialInterval
-
-	for attempt := 0; attempt <= maxRetries; attempt++ {
-		// メッセージ送信を試行
-		res, err := mqc.ReceiveMessage(context.Background())
-		if err == nil {
-			return res, nil
-		}
-
-		// 最大試行回数に達したらエラーを返す
-		if attempt == maxRetries {
-			return nil, err
-		}
-
-		log.Printf("Receive message failed (attempt %d/%d): %v. Retrying in %v...", attempt, maxRetries, err, interval)
-
-		// キャンセルされてたら中断
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-
-		// 待機（指数バックオフ）
-		time.Sleep(interval)
-		interval *= 2
+	if *maxAttempts == 0 {
+		slog.Error("Invalid -max-attempts", "max_attempts", *maxAttempts)
+		os.Exit(1)
 	}
 
-	return nil, errors.New("unreachable code in receiveMessageWithRetry")
-}
-
-func convertPNG2JPG(imageBytes []byte) ([]byte, error) {
-	contentType := http.DetectContentType(imageBytes)
-
-	switch contentType {
-	case "image/png":
-		img, err := png.Decode(bytes.NewReader(imageBytes))
-		if err != nil {
-			return nil, err
-		}
-
-		buf := new(bytes.Buffer)
-		if err := jpeg.Encode(buf, img, nil); err != nil {
-			return nil, err
-		}
-
-		return buf.Bytes(), nil
+	if *maxErrors < 0 {
+		slog.Error("Invalid -max-errors", "max_errors", *maxErrors)
+		os.Exit(1)
 	}
 
-	return nil, fmt.Errorf("unable to convert %#v to jpeg", contentType)
-}
-
-func uploadDeckImage(deckCode string) error {
-	ctx := context.Background()
-	cfg, err := awsConfig.LoadDefaultConfig(ctx)
+	db, err := postgres.NewDB(cfg.DB.Hostname, cfg.DB.Port, cfg.DB.UserName, cfg.DB.UserPassword, cfg.DB.Name)
 	if err != nil {
-		return err
+		slog.Error("Failed to connect database", logging.Err(err))
+		os.Exit(1)
 	}
 
-	baseEndpoint := "https://s3.isk01.sakurastorage.jp"
-	s3client := s3.NewFromConfig(cfg, func(options *s3.Options) {
-		options.BaseEndpoint = &baseEndpoint
-	})
-
-	// すでにアップロードされている場合はスキップする
-	if _, err = s3client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String("vsrecorder"),
-		Key:    aws.String(fmt.Sprintf("images/decks/%s.jpg", deckCode)),
-	}); err != nil {
-		var noKey *types.NoSuchKey
-		if errors.As(err, &noKey) {
-			url := fmt.Sprintf("https://www.pokemon-card.com/deck/deckView.php/deckID/%s.png", deckCode)
-
-			resp, err := http.Get(url)
-			if err != nil {
-				return err
-			}
-			defer resp.Body.Close()
-
-			srcImg, _, err := image.Decode(resp.Body)
-			if err != nil {
-				return err
-			}
+	var mqc simplemq.SimpleMQ
+	if cfg.MQ.File != "" {
+		mqc = simplemq.NewFileMQ(cfg.MQ.File, simplemq.DefaultVisibilityTimeout, simplemq.DefaultRetentionPeriod)
+	} else {
+		mqc = simplemq.NewSimpleMQClientWithBaseURL(cfg.MQ.BaseURL, cfg.MQ.Name, cfg.MQ.Token)
+	}
 
-			var w bytes.Buffer
-			err = png.Encode(&w, srcImg)
-			if err != nil {
-				return err
-			}
+	// デッキ画像は deckimages が別のキューから受け取ってアップロードする
+	var imageMQ simplemq.SimpleMQ
+	if cfg.DeckImageMQ.File != "" {
+		imageMQ = simplemq.NewFileMQ(cfg.DeckImageMQ.File, simplemq.DefaultVisibilityTimeout, simplemq.DefaultRetentionPeriod)
+	} else {
+		imageMQ = simplemq.NewSimpleMQClientWithBaseURL(cfg.DeckImageMQ.BaseURL, cfg.DeckImageMQ.Name, cfg.DeckImageMQ.Token)
+	}
 
-			imageBytes, err := convertPNG2JPG(w.Bytes())
-			if err != nil {
-				return err
-			}
+	var ers eventresult.EventResultSource
+	if *resultsDir != "" {
+		ers = eventresult.NewFileEventResultSource(*resultsDir)
+	} else {
+		ers = eventresult.NewHTTPEventResultSource(cfg.API.ResultsBaseURL)
+	}
 
-			if _, err = s3client.PutObject(ctx, &s3.PutObjectInput{
-				ACL:    "public-read",
-				Bucket: aws.String("vsrecorder"),
-				Key:    aws.String(fmt.Sprintf("images/decks/%s.jpg", deckCode)),
-				Body:   bytes.NewReader(imageBytes),
-			}); err != nil {
-				return err
-			}
-		} else {
-			return err
+	var classifier *archetype.Classifier
+	if cfg.Archetype.RulesFile != "" {
+		classifier, err = archetype.LoadClassifier(cfg.Archetype.RulesFile)
+		if err != nil {
+			slog.Error("Failed to load archetype rules", logging.Err(err))
+			os.Exit(1)
 		}
 	}
 
-	return nil
-}
-
-// エラーチャンネルを使用してゴルーチンからのエラーを受け取る
-type workerError struct {
-	err      error
-	exitCode int
-	message  string
-}
-
-func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Failed to load .env file: %v", err)
+	tracker := deadletter.NewTracker(db, deadletter.QueueImport, *maxAttempts)
+	m := metrics.New("dequeue")
+	// エラーチャンネルに入りきらなかったものも含めて、すべてのエラーを数える
+	agg := failure.NewAggregator(*maxErrors)
+	sink, err := mackerel.NewSink(cfg.Mackerel.Sink, cfg.Mackerel.File, cfg.Mackerel.BaseURL, cfg.Mackerel.APIKey)
+	if err != nil {
+		slog.Error("Invalid Mackerel sink", logging.Err(err))
 		os.Exit(1)
 	}
-
-	if _, err := awsConfig.LoadDefaultConfig(context.Background()); err != nil {
-		log.Printf("Failed to load default aws config: %v", err)
+	reporter := mackerel.NewReporter(sink, cfg.Mackerel.Service, "import-cityleague-result-job.dequeue")
+	// 開催期間は数件しかないので、起動時にまとめて読み込む
+	scheduleRepo, err := repository.NewCachedScheduleRepository(context.Background(), postgres.NewScheduleRepository(db))
+	if err != nil {
+		slog.Error("Failed to load cityleague schedules", logging.Err(err))
 		os.Exit(1)
 	}
+	resultRepo := postgres.NewResultRepository(db)
+	pendingRepo := postgres.NewPendingEventRepository(db)
+	deckRepo := postgres.NewDeckRepository(db)
 
-	dbHostname := os.Getenv("DB_HOSTNAME")
-	dbPort := os.Getenv("DB_PORT")
-	userName := os.Getenv("DB_USER_NAME")
-	userPassword := os.Getenv("DB_USER_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-	mqName := os.Getenv("MQ_NAME")
-	mqToken := os.Getenv("MQ_TOKEN")
+	imp := importer.NewImporter(ers, scheduleRepo, resultRepo, pendingRepo, deckRepo, classifier, imageMQ, m)
 
-	db, err := postgres.NewDB(dbHostname, dbPort, userName, userPassword, dbName)
+	// 実行ごとの処理件数とエラーを import_runs に記録する
+	ledger, err := importrun.Start(context.Background(), postgres.NewImportRunRepository(db), "dequeue")
 	if err != nil {
-		log.Printf("Failed to load connect database: %v", err)
+		slog.Error("Failed to record start of import run", logging.Err(err))
 		os.Exit(1)
 	}
+	slog.Info("Import run started", logging.KeyRunID, ledger.ID())
 
-	mqc := simplemq.NewSimpleMQClient(mqName, mqToken)
+	requeueError := func(eventId uint, message string, err error) {
+		m.Error(metrics.CategorySchedule)
+		agg.Add(metrics.CategorySchedule, 1)
+		ledger.Error(metrics.CategorySchedule, message, err, eventId, "")
+		slog.Error(message, logging.KeyEventID, eventId, logging.KeyStage, metrics.CategorySchedule, logging.Err(err))
+	}
+	if err := imp.RequeuePendingEvents(context.Background(), mqc, requeueError); err != nil {
+		requeueError(0, "Failed to find pending events", err)
+	}
 
-	errorChan := make(chan workerError, errorMaxNum)
-	semChan := make(chan struct{}, concurrencyMaxNum)
+	// シグナルを受け取ったら新しいメッセージの受信をやめる
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	var wg sync.WaitGroup
-	for {
-		res, err := receiveMessageWithRetry(context.Background(), mqc)
+	w := worker.NewWorker(mqc, tracker, m, agg, ledger, concurrencyMaxNum, *heartbeatInterval, *shutdownTimeout)
+	w.Run(ctx, func(ctx context.Context, msg *simplemq.Message) error {
+		// 壊れたメッセージは何度受信しても処理できないので、すぐに dead letter に移す
+		event, err := importer.DecodeEvent(msg.Content)
 		if err != nil {
-			log.Printf("Failed to receive message from MQ: %v", err)
-			continue
-		}
-
-		if len(res.Messages) == 0 {
-			break
+			return &worker.Error{
+				Category: metrics.CategoryDecode,
+				Message:  "Invalid message",
+				Err:      err,
+				Discard:  true,
+			}
 		}
 
-		msg := res.Messages[0]
+		logger := slog.With(logging.KeyMsgID, msg.ID, logging.KeyEventID, event.ID)
 
-		v, err := base64.StdEncoding.DecodeString(msg.Content)
+		result, err := imp.Import(ctx, event, msg.Content)
 		if err != nil {
-			log.Printf("Invalid base64 in message %v, skipping: %v", msg.ID, err)
-			continue
+			werr := &worker.Error{
+				Category: metrics.CategoryImport,
+				Message:  "Failed to import event",
+				Err:      err,
+				EventID:  event.ID,
+				Attrs:    []any{logging.KeyEventID, event.ID},
+			}
+			var ierr *importer.Error
+			if errors.As(err, &ierr) {
+				werr.Category = ierr.Category
+				werr.Message = ierr.Message
+				werr.Err = ierr.Err
+				werr.Attrs = append(werr.Attrs, ierr.Attrs...)
+			}
+			return werr
 		}
 
-		var event OfficialEvent
-		if err := json.Unmarshal(v, &event); err != nil {
-			log.Printf("Invalid JSON in message %v, skipping: %v", msg.ID, err)
-			continue
+		switch result.Status {
+		case importer.StatusNoResults:
+			// 結果がない場合はスキップ
+			logger.Info("No results found, skipping", logging.KeyStage, metrics.StageEventResults)
+			return worker.ErrRedeliver
+		case importer.StatusParked:
+			logger.Info("No cityleague schedule covers the event, parked until one is added", "date", event.Date.Format(time.DateOnly))
+			return nil
 		}
 
-		{
-			semChan <- struct{}{}
-			wg.Add(1)
-			go func(event OfficialEvent, msgId string) {
-				defer func() {
-					wg.Done()
-					<-semChan
-				}()
-
-				// ゴルーチン内でのpanic保護
-				defer func() {
-					if r := recover(); r != nil {
-						errorChan <- workerError{
-							err:      fmt.Errorf("panic recovered: %v", r),
-							exitCode: 1,
-							message:  "Unexpected panic occurred in worker goroutine",
-						}
-					}
-				}()
-
-				var leagueType uint
-				switch event.LeagueTitle {
-				case "オープン":
-					leagueType = 1
-				case "ジュニア":
-					leagueType = 2
-				case "シニア":
-					leagueType = 3
-				case "マスター":
-					leagueType = 4
-				default:
-					leagueType = 0
-				}
-
-				// イベントの結果を取得
-				results, err := getEventResults(event.ID)
-				if err != nil {
-					select {
-					case errorChan <- workerError{
-						err:      err,
-						exitCode: 1,
-						message:  fmt.Sprintf("Failed to get event results for event ID %d", event.ID),
-					}:
-					default:
-					}
-					return
-				}
-
-				if len(results) == 0 {
-					// 結果がない場合はスキップ
-					log.Printf("No results found for event ID %d, skipping", event.ID)
-					return
-				}
-
-				// 対象期間中のシティーリーグのIDを取得する
-				var cs model.CityleagueSchedule
-				if tx := db.Where("from_date <= ? AND to_date >= ?", event.Date, event.Date).First(&cs); tx.Error != nil {
-					select {
-					case errorChan <- workerError{
-						err:      tx.Error,
-						exitCode: 1,
-						message:  fmt.Sprintf("Failed to find cityleague schedule for date %v", event.Date),
-					}:
-					default:
-					}
-					return
-				}
-
-				cityleagueScheduleId := cs.ID
-
-				for _, result := range results {
-					// デッキコードがある場合は画像をアップロードする
-					if result.DeckId != "" {
-						if err := uploadDeckImage(result.DeckId); err != nil {
-							select {
-							case errorChan <- workerError{
-								err:      err,
-								exitCode: 1,
-								message:  fmt.Sprintf("Failed to upload deck image for deck ID %s", result.DeckId),
-							}:
-							default:
-							}
-							return
-						}
-					}
-
-					m := model.NewCityleagueResult(
-						cityleagueScheduleId,
-						event.ID,
-						leagueType,
-						event.Date,
-						result.PlayerId,
-						result.Name,
-						result.Rank,
-						result.Point,
-						result.DeckId,
-					)
-
-					log.Printf("CityleagueResult: %v", m)
-
-					if tx := db.Save(&m); tx.Error != nil {
-						var pgErr *pgconn.PgError
-						if errors.As(tx.Error, &pgErr) && pgErr.Code == "23505" {
-							continue
-						} else {
-							select {
-							case errorChan <- workerError{
-								err:      tx.Error,
-								exitCode: 1,
-								message:  fmt.Sprintf("Failed to insert cityleague result for player ID %s", result.PlayerId),
-							}:
-							default:
-							}
-							return
-						}
-					}
-				}
-
-				// キューから削除
-				if err := mqc.DeleteMessage(context.Background(), msgId); err != nil {
-					select {
-					case errorChan <- workerError{
-						err:      err,
-						exitCode: 1,
-						message:  fmt.Sprintf("Failed to delete message %v from MQ", msgId),
-					}:
-					default:
-					}
-					return
-				}
-			}(event, msg.ID)
-		}
+		ledger.EventImported(result.Stats)
+		ledger.ImagesEnqueued(result.ImagesEnqueued)
+		logger.Info("Imported cityleague results",
+			logging.KeyStage, metrics.StageImport,
+			"inserted", result.Stats.Inserted,
+			"updated", result.Stats.Updated,
+			"unchanged", result.Stats.Unchanged,
+			"deleted", result.Stats.Deleted,
+			"images_enqueued", result.ImagesEnqueued,
+		)
+
+		return nil
+	})
+
+	if err := ledger.Finish(context.Background(), ctx.Err() != nil); err != nil {
+		slog.Error("Failed to record end of import run", logging.KeyRunID, ledger.ID(), logging.Err(err))
 	}
 
-	// エラー集約
-	go func() {
-		wg.Wait()
-		close(errorChan)
-	}()
+	// エラーが閾値を超えた場合は systemd や mkr wrap が失敗を検知できるように異常終了する
+	exitCode := agg.ExitCode()
+
+	m.Finish(exitCode == 0)
+	if err := m.Export(context.Background(), cfg.Metrics.TextfileDir, cfg.Metrics.PushURL); err != nil {
+		slog.Error("Failed to export metrics", logging.Err(err))
+	}
+
+	if err := reporter.Report(context.Background(), m); err != nil {
+		slog.Error("Failed to report metrics to Mackerel", logging.Err(err))
+	}
+
+	if ctx.Err() != nil {
+		slog.Info("Shutdown completed")
+	}
 
-	for workerErr := range errorChan {
-		log.Printf("%s: %v", workerErr.message, workerErr.err)
+	switch {
+	case exitCode != 0:
+		slog.Error("Dequeue job failed, too many errors", agg.Attrs()...)
+	case agg.Total() > 0:
+		slog.Warn("Dequeue job completed with errors", agg.Attrs()...)
+	default:
+		slog.Info("Dequeue job completed", agg.Attrs()...)
 	}
 
-	os.Exit(0)
+	os.Exit(exitCode)
 }
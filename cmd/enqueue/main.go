@@ -5,20 +5,29 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/config"
 	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/mackerel"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/metrics"
 )
 
 const (
 	maxRetries      = 5
 	initialInterval = 500 * time.Millisecond
+
+	dateLayout       = "2006-01-02"
+	defaultStateFile = ".enqueue_last_run"
 )
 
 type OfficialEvent struct {
@@ -46,7 +55,7 @@ type OfficialEventGetResponse struct {
 	OfficialEvents []*OfficialEvent `json:"official_events"`
 }
 
-func getEvents(date time.Time) ([]*OfficialEvent, error) {
+func getEvents(baseURL string, date time.Time) ([]*OfficialEvent, error) {
 	startDateYear := uint16(date.Year())
 	startDateMonth := uint8(date.Month())
 	startDateDay := uint8(date.Day())
@@ -56,7 +65,8 @@ func getEvents(date time.Time) ([]*OfficialEvent, error) {
 	endDateDay := uint8(date.Day())
 
 	res, err := http.Get(fmt.Sprintf(
-		"https://beta.vsrecorder.mobi/api/v1beta/official_events?type_id=2&league_type=0&start_date=%d-%02d-%02d&end_date=%d-%02d-%02d",
+		"%s/api/v1beta/official_events?type_id=2&league_type=0&start_date=%d-%02d-%02d&end_date=%d-%02d-%02d",
+		strings.TrimSuffix(baseURL, "/"),
 		startDateYear, startDateMonth, startDateDay, endDateYear, endDateMonth, endDateDay),
 	)
 	if err != nil {
@@ -96,7 +106,7 @@ func sendMessageWithRetry(ctx context.Context, mqc simplemq.SimpleMQ, v []byte)
 			return err
 		}
 
-		log.Printf("Send message failed (attempt %d/%d): %v. Retrying in %v...", attempt, maxRetries, err, interval)
+		slog.Warn("Send message failed, retrying", "attempt", attempt, "max_retries", maxRetries, "retry_in", interval, logging.Err(err))
 
 		// キャンセルされてたら中断
 		if ctx.Err() != nil {
@@ -111,39 +121,196 @@ func sendMessageWithRetry(ctx context.Context, mqc simplemq.SimpleMQ, v []byte)
 	return errors.New("unreachable code in sendMessageWithRetry")
 }
 
-func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+func parseDate(s string) (time.Time, error) {
+	return time.ParseInLocation(dateLayout, s, time.Local)
+}
 
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Failed to load .env file: %v", err)
-		os.Exit(1)
+func truncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// 前回正常終了した日付を読み込む
+func loadLastRunDate(path string) (time.Time, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
 	}
 
-	mqName := os.Getenv("MQ_NAME")
-	mqToken := os.Getenv("MQ_TOKEN")
-	mqc := simplemq.NewSimpleMQClient(mqName, mqToken)
+	return parseDate(strings.TrimSpace(string(b)))
+}
+
+// 正常終了した日付を保存する
+func saveLastRunDate(path string, date time.Time) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(date.Format(dateLayout)+"\n"), 0644); err != nil {
+		return err
+	}
 
-	date := time.Now()
+	return os.Rename(tmp, path)
+}
 
-	var events []*OfficialEvent
-	events, err := getEvents(date)
+// 指定された日付のイベントをすべてキューに登録し、登録件数を返す
+func enqueueEvents(ctx context.Context, mqc simplemq.SimpleMQ, m *metrics.Metrics, eventsBaseURL string, date time.Time) (int, error) {
+	done := m.Time(metrics.StageGetEvents)
+	events, err := getEvents(eventsBaseURL, date)
+	done()
 	if err != nil {
-		log.Printf("Failed to get events for date %s: %v", date.Format("2006-01-02"), err)
-		os.Exit(1)
+		m.Error(metrics.CategoryGetEvents)
+		return 0, fmt.Errorf("failed to get events for date %s: %w", date.Format(dateLayout), err)
 	}
 
+	count := 0
 	for _, event := range events {
 		v, err := json.Marshal(*event)
 		if err != nil {
-			log.Printf("Failed to marshal event to JSON: %v", err)
+			return count, fmt.Errorf("failed to marshal event to JSON [id: %d]: %w", event.ID, err)
+		}
+
+		if err := sendMessageWithRetry(ctx, mqc, v); err != nil {
+			m.Error(metrics.CategoryEnqueue)
+			return count, fmt.Errorf("failed to send message to MQ [id: %d]: %w", event.ID, err)
+		}
+
+		slog.Debug("Event enqueued", logging.KeyEventID, event.ID, "date", date.Format(dateLayout))
+		m.EventsEnqueued.Inc()
+		count++
+	}
+
+	return count, nil
+}
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		slog.Error("Failed to load .env file", logging.Err(err))
+		os.Exit(1)
+	}
+
+	cfg := config.FromEnv()
+	cfg.MQ.RegisterFlags(flag.CommandLine)
+	cfg.API.RegisterEventsFlags(flag.CommandLine)
+	cfg.Metrics.RegisterFlags(flag.CommandLine)
+	cfg.Mackerel.RegisterFlags(flag.CommandLine)
+	cfg.Log.RegisterFlags(flag.CommandLine)
+
+	from := flag.String("from", "", "first date to enqueue (YYYY-MM-DD, default: today)")
+	to := flag.String("to", "", "last date to enqueue (YYYY-MM-DD, default: today)")
+	sinceLastRun := flag.Bool("since-last-run", false, "enqueue every day after the last successful run up to -to")
+	stateFile := flag.String("state-file", defaultStateFile, "file recording the last successfully enqueued date")
+	flag.Parse()
+
+	if err := logging.Setup(cfg.Log.Format, cfg.Log.Level); err != nil {
+		slog.Error("Invalid log configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	if err := errors.Join(cfg.MQ.Validate(), cfg.API.ValidateEvents(), cfg.Metrics.Validate(), cfg.Mackerel.Validate()); err != nil {
+		slog.Error("Invalid configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	var mqc simplemq.SimpleMQ
+	if cfg.MQ.File != "" {
+		mqc = simplemq.NewFileMQ(cfg.MQ.File, simplemq.DefaultVisibilityTimeout, simplemq.DefaultRetentionPeriod)
+	} else {
+		mqc = simplemq.NewSimpleMQClientWithBaseURL(cfg.MQ.BaseURL, cfg.MQ.Name, cfg.MQ.Token)
+	}
+
+	today := truncateToDay(time.Now())
+
+	endDate := today
+	if *to != "" {
+		d, err := parseDate(*to)
+		if err != nil {
+			slog.Error("Invalid -to date", "to", *to, logging.Err(err))
 			os.Exit(1)
 		}
+		endDate = d
+	}
+
+	lastRunDate, err := loadLastRunDate(*stateFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("Failed to load last run date", "state_file", *stateFile, logging.Err(err))
+		os.Exit(1)
+	}
+
+	startDate := endDate
+	switch {
+	case *sinceLastRun && *from != "":
+		slog.Error("-from and -since-last-run cannot be used together")
+		os.Exit(1)
+	case *sinceLastRun:
+		if lastRunDate.IsZero() {
+			// 初回実行時は終了日のみを対象にする
+			slog.Info("No last run date found, enqueueing the end date only", "state_file", *stateFile, "date", endDate.Format(dateLayout))
+		} else {
+			startDate = lastRunDate.AddDate(0, 0, 1)
+		}
+	case *from != "":
+		d, err := parseDate(*from)
+		if err != nil {
+			slog.Error("Invalid -from date", "from", *from, logging.Err(err))
+			os.Exit(1)
+		}
+		startDate = d
+	}
+
+	if startDate.After(endDate) {
+		if *sinceLastRun {
+			slog.Info("Already enqueued up to the end date, nothing to do", "date", endDate.Format(dateLayout))
+			os.Exit(0)
+		}
+		slog.Error("Start date is after end date", "from", startDate.Format(dateLayout), "to", endDate.Format(dateLayout))
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	m := metrics.New("enqueue")
+	sink, err := mackerel.NewSink(cfg.Mackerel.Sink, cfg.Mackerel.File, cfg.Mackerel.BaseURL, cfg.Mackerel.APIKey)
+	if err != nil {
+		slog.Error("Invalid Mackerel sink", logging.Err(err))
+		os.Exit(1)
+	}
+	reporter := mackerel.NewReporter(sink, cfg.Mackerel.Service, "import-cityleague-result-job.enqueue")
+	exportMetrics := func(succeeded bool) {
+		m.Finish(succeeded)
+
+		if err := m.Export(ctx, cfg.Metrics.TextfileDir, cfg.Metrics.PushURL); err != nil {
+			slog.Error("Failed to export metrics", logging.Err(err))
+		}
 
-		if err := sendMessageWithRetry(context.Background(), mqc, v); err != nil {
-			log.Printf("Failed to send message to MQ [id: %d]: %v ", event.ID, err)
+		if err := reporter.Report(ctx, m); err != nil {
+			slog.Error("Failed to report metrics to Mackerel", logging.Err(err))
+		}
+	}
+
+	total := 0
+	for date := startDate; !date.After(endDate); date = date.AddDate(0, 0, 1) {
+		count, err := enqueueEvents(ctx, mqc, m, cfg.API.EventsBaseURL, date)
+		total += count
+		if err != nil {
+			slog.Error("Failed to enqueue events", "date", date.Format(dateLayout), "enqueued", count, logging.Err(err))
+			exportMetrics(false)
 			os.Exit(1)
 		}
+
+		slog.Info("Events enqueued", "date", date.Format(dateLayout), "enqueued", count)
+
+		// 日付単位で進捗を記録し、途中で失敗しても次回は続きから再開できるようにする
+		// 過去分のバックフィルでは記録を巻き戻さない
+		if date.After(lastRunDate) {
+			if err := saveLastRunDate(*stateFile, date); err != nil {
+				slog.Error("Failed to save last run date", "state_file", *stateFile, logging.Err(err))
+				exportMetrics(false)
+				os.Exit(1)
+			}
+			lastRunDate = date
+		}
 	}
 
+	slog.Info("Enqueue completed", "from", startDate.Format(dateLayout), "to", endDate.Format(dateLayout), "enqueued", total)
+
+	exportMetrics(true)
+
 	os.Exit(0)
 }
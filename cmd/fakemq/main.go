@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/config"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+)
+
+// SimpleMQ の REST API を模したローカル用のサーバ
+type server struct {
+	token             string
+	dataDir           string
+	visibilityTimeout time.Duration
+	retentionPeriod   time.Duration
+
+	mu     sync.Mutex
+	queues map[string]simplemq.SimpleMQ
+}
+
+func newServer(token, dataDir string, visibilityTimeout, retentionPeriod time.Duration) *server {
+	return &server{
+		token:             token,
+		dataDir:           dataDir,
+		visibilityTimeout: visibilityTimeout,
+		retentionPeriod:   retentionPeriod,
+		queues:            map[string]simplemq.SimpleMQ{},
+	}
+}
+
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+type resultResponse struct {
+	Result string `json:"result"`
+}
+
+func (s *server) queue(name string) simplemq.SimpleMQ {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.queues[name]
+	if !ok {
+		if s.dataDir != "" {
+			q = simplemq.NewFileMQ(filepath.Join(s.dataDir, name+".mq"), s.visibilityTimeout, s.retentionPeriod)
+		} else {
+			q = simplemq.NewMemoryMQ(s.visibilityTimeout, s.retentionPeriod)
+		}
+		s.queues[name] = q
+	}
+
+	return q
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write response", logging.Err(err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, &errorResponse{Message: message})
+}
+
+func writeQueueError(w http.ResponseWriter, err error) {
+	if errors.Is(err, simplemq.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "message not found")
+		return
+	}
+
+	slog.Error("Queue operation failed", logging.Err(err))
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// Bearer トークンを検証する
+func (s *server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.token {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *server) sendMessage(w http.ResponseWriter, r *http.Request) {
+	var msgReq simplemq.SendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&msgReq); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if msgReq.Content == "" {
+		writeError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+
+	res, err := s.queue(r.PathValue("name")).SendMessage(r.Context(), &msgReq)
+	if err != nil {
+		writeQueueError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *server) receiveMessage(w http.ResponseWriter, r *http.Request) {
+	res, err := s.queue(r.PathValue("name")).ReceiveMessage(r.Context())
+	if err != nil {
+		writeQueueError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *server) updateMessageTimeout(w http.ResponseWriter, r *http.Request) {
+	if err := s.queue(r.PathValue("name")).UpdateMessageTimeout(r.Context(), r.PathValue("id")); err != nil {
+		writeQueueError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &resultResponse{Result: "success"})
+}
+
+func (s *server) deleteMessage(w http.ResponseWriter, r *http.Request) {
+	if err := s.queue(r.PathValue("name")).DeleteMessage(r.Context(), r.PathValue("id")); err != nil {
+		writeQueueError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &resultResponse{Result: "success"})
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/queues/{name}/messages", s.auth(s.sendMessage))
+	mux.HandleFunc("GET /v1/queues/{name}/messages", s.auth(s.receiveMessage))
+	mux.HandleFunc("PUT /v1/queues/{name}/messages/{id}", s.auth(s.updateMessageTimeout))
+	mux.HandleFunc("DELETE /v1/queues/{name}/messages/{id}", s.auth(s.deleteMessage))
+
+	return mux
+}
+
+func main() {
+	logConfig := config.FromEnv().Log
+	logConfig.RegisterFlags(flag.CommandLine)
+
+	addr := flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	token := flag.String("token", os.Getenv("MQ_TOKEN"), "bearer token clients must present (default: $MQ_TOKEN)")
+	dataDir := flag.String("data-dir", "", "persist queues as files in this directory instead of memory")
+	visibilityTimeout := flag.Duration("visibility-timeout", simplemq.DefaultVisibilityTimeout, "visibility timeout of received messages")
+	retentionPeriod := flag.Duration("retention-period", simplemq.DefaultRetentionPeriod, "how long messages are kept before they expire")
+	flag.Parse()
+
+	if err := logging.Setup(logConfig.Format, logConfig.Level); err != nil {
+		slog.Error("Invalid log configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	if *token == "" {
+		slog.Error("A token is required: set -token or MQ_TOKEN")
+		os.Exit(1)
+	}
+
+	if *dataDir != "" {
+		if err := os.MkdirAll(*dataDir, 0755); err != nil {
+			slog.Error("Failed to create data directory", "data_dir", *dataDir, logging.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	s := newServer(*token, *dataDir, *visibilityTimeout, *retentionPeriod)
+
+	slog.Info("Listening", "addr", *addr)
+	if err := http.ListenAndServe(*addr, s.handler()); err != nil {
+		slog.Error("Server stopped", logging.Err(err))
+		os.Exit(1)
+	}
+}
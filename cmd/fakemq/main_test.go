@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+)
+
+// 本番と同じ SimpleMQClient で fakemq に接続する
+func TestSimpleMQClient(t *testing.T) {
+	srv := httptest.NewServer(newServer("local", t.TempDir(), time.Minute, time.Hour).handler())
+	defer srv.Close()
+
+	ctx := context.Background()
+	mqc := simplemq.NewSimpleMQClientWithBaseURL(srv.URL, "import", "local")
+
+	sent, err := mqc.SendMessage(ctx, &simplemq.SendMessageRequest{Content: `{"event_id":1}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.Result != "success" || sent.Message.ID == "" {
+		t.Fatalf("SendMessage() = %+v", sent)
+	}
+
+	res, err := mqc.ReceiveMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Messages) != 1 {
+		t.Fatalf("ReceiveMessage() = %d messages, want 1", len(res.Messages))
+	}
+	msg := res.Messages[0]
+	if msg.ID != sent.Message.ID || msg.Content != `{"event_id":1}` {
+		t.Errorf("ReceiveMessage() = %+v, want %+v", msg, sent.Message)
+	}
+	if msg.AcquiredAt.IsZero() || !msg.VisibilityTimeoutAt.After(msg.AcquiredAt) {
+		t.Errorf("ReceiveMessage() did not set the visibility timeout: %+v", msg)
+	}
+
+	// 受信中のメッセージは返らない
+	res, err = mqc.ReceiveMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Messages) != 0 {
+		t.Errorf("ReceiveMessage() during the visibility timeout = %+v", res.Messages)
+	}
+
+	// 別のキューとは混ざらない
+	other := simplemq.NewSimpleMQClientWithBaseURL(srv.URL, "deck_images", "local")
+	if res, err := other.ReceiveMessage(ctx); err != nil || len(res.Messages) != 0 {
+		t.Errorf("ReceiveMessage() of another queue = %v, %v", res, err)
+	}
+
+	if err := mqc.UpdateMessageTimeout(ctx, msg.ID); err != nil {
+		t.Errorf("UpdateMessageTimeout() error = %v", err)
+	}
+	if err := mqc.DeleteMessage(ctx, msg.ID); err != nil {
+		t.Errorf("DeleteMessage() error = %v", err)
+	}
+
+	if err := mqc.UpdateMessageTimeout(ctx, msg.ID); !errors.Is(err, simplemq.ErrNotFound) {
+		t.Errorf("UpdateMessageTimeout() of a deleted message error = %v, want ErrNotFound", err)
+	}
+	if err := mqc.DeleteMessage(ctx, msg.ID); !errors.Is(err, simplemq.ErrNotFound) {
+		t.Errorf("DeleteMessage() of a deleted message error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSimpleMQClientUnauthorized(t *testing.T) {
+	srv := httptest.NewServer(newServer("local", "", time.Minute, time.Hour).handler())
+	defer srv.Close()
+
+	ctx := context.Background()
+	mqc := simplemq.NewSimpleMQClientWithBaseURL(srv.URL, "import", "wrong")
+
+	if _, err := mqc.SendMessage(ctx, &simplemq.SendMessageRequest{Content: "x"}); err == nil || err.Error() != "401 Unauthorized" {
+		t.Errorf("SendMessage() error = %v, want 401 Unauthorized", err)
+	}
+	if _, err := mqc.ReceiveMessage(ctx); err == nil || err.Error() != "401 Unauthorized" {
+		t.Errorf("ReceiveMessage() error = %v, want 401 Unauthorized", err)
+	}
+	// 認証エラーはメッセージがないこととは区別する
+	if err := mqc.UpdateMessageTimeout(ctx, "id"); err == nil || errors.Is(err, simplemq.ErrNotFound) {
+		t.Errorf("UpdateMessageTimeout() error = %v, want 401 Unauthorized", err)
+	}
+	if err := mqc.DeleteMessage(ctx, "id"); err == nil || errors.Is(err, simplemq.ErrNotFound) {
+		t.Errorf("DeleteMessage() error = %v, want 401 Unauthorized", err)
+	}
+}
+
+func TestSimpleMQClientStatus(t *testing.T) {
+	s := newServer("local", "", time.Minute, time.Hour)
+	mux := http.NewServeMux()
+	mux.Handle("/v1/queues/import/", s.handler())
+	// 障害中のキュー
+	mux.HandleFunc("/v1/queues/broken/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusServiceUnavailable, "maintenance")
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		queue   string
+		content string
+		want    string
+	}{
+		{name: "empty content", queue: "import", content: "", want: "400 Bad Request"},
+		{name: "unavailable", queue: "broken", content: "x", want: "503 Service Unavailable"},
+	}
+
+	for _, tt := range tests {
+		mqc := simplemq.NewSimpleMQClientWithBaseURL(srv.URL, tt.queue, "local")
+		if _, err := mqc.SendMessage(ctx, &simplemq.SendMessageRequest{Content: tt.content}); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: SendMessage() error = %v, want %s", tt.name, err, tt.want)
+		}
+	}
+
+	broken := simplemq.NewSimpleMQClientWithBaseURL(srv.URL, "broken", "local")
+	if _, err := broken.ReceiveMessage(ctx); err == nil || err.Error() != "503 Service Unavailable" {
+		t.Errorf("ReceiveMessage() error = %v, want 503 Service Unavailable", err)
+	}
+	if err := broken.DeleteMessage(ctx, "id"); err == nil || errors.Is(err, simplemq.ErrNotFound) {
+		t.Errorf("DeleteMessage() error = %v, want 503 Service Unavailable", err)
+	}
+}
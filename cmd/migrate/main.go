@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/config"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/postgres"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] up [N] | down [N] | status\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func parseCount(args []string, defaultValue int) (int, error) {
+	if len(args) < 2 {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid count %q", args[1])
+	}
+
+	return n, nil
+}
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		slog.Error("Failed to load .env file", logging.Err(err))
+		os.Exit(1)
+	}
+
+	cfg := config.FromEnv()
+	cfg.DB.RegisterFlags(flag.CommandLine)
+	cfg.Log.RegisterFlags(flag.CommandLine)
+	flag.Usage = usage
+	flag.Parse()
+
+	if err := logging.Setup(cfg.Log.Format, cfg.Log.Level); err != nil {
+		slog.Error("Invalid log configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	args := flag.Args()
+	if len(args) == 0 || len(args) > 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cfg.DB.Validate(); err != nil {
+		slog.Error("Invalid configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	db, err := postgres.NewDB(cfg.DB.Hostname, cfg.DB.Port, cfg.DB.UserName, cfg.DB.UserPassword, cfg.DB.Name)
+	if err != nil {
+		slog.Error("Failed to connect database", logging.Err(err))
+		os.Exit(1)
+	}
+
+	migrator, err := postgres.NewMigrator(db)
+	if err != nil {
+		slog.Error("Failed to load migrations", logging.Err(err))
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		// デフォルトではすべて適用する
+		n, err := parseCount(args, 0)
+		if err != nil {
+			slog.Error("Invalid count", logging.Err(err))
+			os.Exit(2)
+		}
+
+		migrated, err := migrator.Up(ctx, n)
+		for _, m := range migrated {
+			slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+		}
+		if err != nil {
+			slog.Error("Failed to apply migrations", logging.Err(err))
+			os.Exit(1)
+		}
+		if len(migrated) == 0 {
+			slog.Info("No migrations to apply")
+		}
+	case "down":
+		// 誤って全て戻さないよう、デフォルトでは1件だけ戻す
+		n, err := parseCount(args, 1)
+		if err != nil {
+			slog.Error("Invalid count", logging.Err(err))
+			os.Exit(2)
+		}
+
+		migrated, err := migrator.Down(ctx, n)
+		for _, m := range migrated {
+			slog.Info("Reverted migration", "version", m.Version, "name", m.Name)
+		}
+		if err != nil {
+			slog.Error("Failed to revert migrations", logging.Err(err))
+			os.Exit(1)
+		}
+		if len(migrated) == 0 {
+			slog.Info("No migrations to revert")
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			slog.Error("Failed to get migration status", logging.Err(err))
+			os.Exit(1)
+		}
+
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Migration.Version, s.Migration.Name, appliedAt)
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	os.Exit(0)
+}
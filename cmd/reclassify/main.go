@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/joho/godotenv"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/archetype"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/config"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/postgres"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+)
+
+// 判定ルールを変更したときに、取り込み済みの成績のアーキタイプを判定し直す
+func main() {
+	if err := godotenv.Load(); err != nil {
+		slog.Error("Failed to load .env file", logging.Err(err))
+		os.Exit(1)
+	}
+
+	cfg := config.FromEnv()
+	cfg.DB.RegisterFlags(flag.CommandLine)
+	cfg.Archetype.RegisterFlags(flag.CommandLine)
+	cfg.Log.RegisterFlags(flag.CommandLine)
+
+	dryRun := flag.Bool("dry-run", false, "classify decks and report the counts without updating results")
+	flag.Parse()
+
+	if err := logging.Setup(cfg.Log.Format, cfg.Log.Level); err != nil {
+		slog.Error("Invalid log configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	if err := errors.Join(cfg.DB.Validate(), cfg.Archetype.Validate()); err != nil {
+		slog.Error("Invalid configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	classifier, err := archetype.LoadClassifier(cfg.Archetype.RulesFile)
+	if err != nil {
+		slog.Error("Failed to load archetype rules", logging.Err(err))
+		os.Exit(1)
+	}
+
+	db, err := postgres.NewDB(cfg.DB.Hostname, cfg.DB.Port, cfg.DB.UserName, cfg.DB.UserPassword, cfg.DB.Name)
+	if err != nil {
+		slog.Error("Failed to connect database", logging.Err(err))
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	resultRepo := postgres.NewResultRepository(db)
+	deckRepo := postgres.NewDeckRepository(db)
+
+	deckCodes, err := resultRepo.FindDeckCodes(ctx)
+	if err != nil {
+		slog.Error("Failed to list deck codes", logging.Err(err))
+		os.Exit(1)
+	}
+
+	counts := map[string]int{}
+	classified := 0
+	var updated int64
+	for _, deckCode := range deckCodes {
+		cards, err := deckRepo.FindCards(ctx, deckCode)
+		if err != nil {
+			slog.Error("Failed to get cards of deck", logging.KeyDeckCode, deckCode, logging.Err(err))
+			os.Exit(1)
+		}
+
+		// カード構成を取得できていないデッキは判定しない
+		if len(cards) == 0 {
+			continue
+		}
+
+		archetypeId := classifier.Classify(cards)
+		counts[archetypeId]++
+		classified++
+
+		if *dryRun {
+			continue
+		}
+
+		n, err := resultRepo.UpdateArchetype(ctx, deckCode, archetypeId)
+		if err != nil {
+			slog.Error("Failed to update archetype of deck", logging.KeyDeckCode, deckCode, logging.Err(err))
+			os.Exit(1)
+		}
+		updated += n
+	}
+
+	archetypeIds := make([]string, 0, len(counts))
+	for archetypeId := range counts {
+		archetypeIds = append(archetypeIds, archetypeId)
+	}
+	sort.Strings(archetypeIds)
+
+	for _, archetypeId := range archetypeIds {
+		name := archetypeId
+		if archetypeId == archetype.Unclassified {
+			name = "(unclassified)"
+		}
+		slog.Info("Archetype count", "archetype_id", name, "decks", counts[archetypeId])
+	}
+
+	if *dryRun {
+		slog.Info("Classified decks (dry run, nothing updated)", "classified", classified)
+	} else {
+		slog.Info("Classified decks", "classified", classified, "updated", updated)
+	}
+
+	os.Exit(0)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/config"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/importrun"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/postgres"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+const (
+	defaultLimit = 20
+
+	timeLayout = "2006-01-02 15:04:05"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [run-id]\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func formatEndedAt(run *model.ImportRun) string {
+	switch {
+	case run.EndedAt == nil:
+		return "running"
+	case run.Interrupted:
+		return run.EndedAt.Local().Format(timeLayout) + " (interrupted)"
+	default:
+		return run.EndedAt.Local().Format(timeLayout)
+	}
+}
+
+func formatDuration(run *model.ImportRun) string {
+	if run.EndedAt == nil {
+		return "-"
+	}
+
+	return run.EndedAt.Sub(run.StartedAt).Round(time.Second).String()
+}
+
+// 実行の一覧を1行ずつ出力する
+func printRuns(runs []*model.ImportRun) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCOMMAND\tSTARTED\tDURATION\tMESSAGES\tEVENTS\tINSERTED\tUPDATED\tUNCHANGED\tDELETED\tIMAGES\tERRORS")
+	for _, run := range runs {
+		images := run.ImagesEnqueued
+		if run.Command == "deckimages" {
+			images = run.ImagesUploaded
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+			run.ID, run.Command, run.StartedAt.Local().Format(timeLayout), formatDuration(run),
+			run.MessagesProcessed, run.EventsImported,
+			run.RowsInserted, run.RowsUpdated, run.RowsUnchanged, run.RowsDeleted,
+			images, run.ErrorCount,
+		)
+	}
+
+	return w.Flush()
+}
+
+// 1回の実行の詳細とエラーを出力する
+func printRun(run *model.ImportRun) error {
+	records, err := importrun.Errors(run)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\t%d\n", run.ID)
+	fmt.Fprintf(w, "Command\t%s\n", run.Command)
+	fmt.Fprintf(w, "Started\t%s\n", run.StartedAt.Local().Format(timeLayout))
+	fmt.Fprintf(w, "Ended\t%s\n", formatEndedAt(run))
+	fmt.Fprintf(w, "Duration\t%s\n", formatDuration(run))
+	fmt.Fprintf(w, "Messages processed\t%d\n", run.MessagesProcessed)
+	fmt.Fprintf(w, "Events imported\t%d\n", run.EventsImported)
+	fmt.Fprintf(w, "Rows inserted\t%d\n", run.RowsInserted)
+	fmt.Fprintf(w, "Rows updated\t%d\n", run.RowsUpdated)
+	fmt.Fprintf(w, "Rows unchanged\t%d\n", run.RowsUnchanged)
+	fmt.Fprintf(w, "Rows deleted\t%d\n", run.RowsDeleted)
+	fmt.Fprintf(w, "Images enqueued\t%d\n", run.ImagesEnqueued)
+	fmt.Fprintf(w, "Images uploaded\t%d\n", run.ImagesUploaded)
+	fmt.Fprintf(w, "Errors\t%d\n", run.ErrorCount)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AT\tCATEGORY\tEVENT\tMSG\tMESSAGE\tERROR")
+	for _, r := range records {
+		eventId := "-"
+		if r.EventId != 0 {
+			eventId = strconv.FormatUint(uint64(r.EventId), 10)
+		}
+		msgId := "-"
+		if r.MsgId != "" {
+			msgId = r.MsgId
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.At.Local().Format(timeLayout), r.Category, eventId, msgId, r.Message, r.Error,
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if run.ErrorCount > len(records) {
+		fmt.Printf("... %d more errors were not recorded\n", run.ErrorCount-len(records))
+	}
+
+	return nil
+}
+
+// import_runs に記録した過去の実行を表示する
+func main() {
+	if err := godotenv.Load(); err != nil {
+		slog.Error("Failed to load .env file", logging.Err(err))
+		os.Exit(1)
+	}
+
+	cfg := config.FromEnv()
+	cfg.DB.RegisterFlags(flag.CommandLine)
+	cfg.Log.RegisterFlags(flag.CommandLine)
+
+	command := flag.String("command", "", "only list runs of this command (dequeue or deckimages)")
+	limit := flag.Int("limit", defaultLimit, "number of most recent runs to list (0 lists all runs)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if err := logging.Setup(cfg.Log.Format, cfg.Log.Level); err != nil {
+		slog.Error("Invalid log configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	args := flag.Args()
+	if len(args) > 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	if *limit < 0 {
+		slog.Error("Invalid -limit", "limit", *limit)
+		os.Exit(2)
+	}
+
+	if err := cfg.DB.Validate(); err != nil {
+		slog.Error("Invalid configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	db, err := postgres.NewDB(cfg.DB.Hostname, cfg.DB.Port, cfg.DB.UserName, cfg.DB.UserPassword, cfg.DB.Name)
+	if err != nil {
+		slog.Error("Failed to connect database", logging.Err(err))
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	runRepo := postgres.NewImportRunRepository(db)
+
+	// 引数がなければ一覧を、ID を指定したらその実行の詳細を表示する
+	if len(args) == 0 {
+		runs, err := runRepo.FindRecent(ctx, *command, *limit)
+		if err != nil {
+			slog.Error("Failed to list import runs", logging.Err(err))
+			os.Exit(1)
+		}
+
+		if err := printRuns(runs); err != nil {
+			slog.Error("Failed to print import runs", logging.Err(err))
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil || id == 0 {
+		slog.Error("Invalid run id", logging.KeyRunID, args[0])
+		os.Exit(2)
+	}
+
+	run, err := runRepo.FindById(ctx, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			slog.Error("Import run not found", logging.KeyRunID, id)
+			os.Exit(1)
+		}
+		slog.Error("Failed to get import run", logging.KeyRunID, id, logging.Err(err))
+		os.Exit(1)
+	}
+
+	if err := printRun(run); err != nil {
+		slog.Error("Failed to print import run", logging.KeyRunID, id, logging.Err(err))
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
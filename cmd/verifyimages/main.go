@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/config"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/deckimage"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/imagestore"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/postgres"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+)
+
+// 保存済みのデッキ画像を記録したハッシュと照合し、欠損・破損している画像をアップロードし直す
+func main() {
+	if err := godotenv.Load(); err != nil {
+		slog.Error("Failed to load .env file", logging.Err(err))
+		os.Exit(1)
+	}
+
+	cfg := config.FromEnv()
+	cfg.DB.RegisterFlags(flag.CommandLine)
+	cfg.Storage.RegisterFlags(flag.CommandLine)
+	cfg.API.RegisterResultsFlags(flag.CommandLine)
+	cfg.DeckImage.RegisterFlags(flag.CommandLine)
+	cfg.Log.RegisterFlags(flag.CommandLine)
+
+	sample := flag.Int("sample", 0, "number of randomly chosen decks to verify (0 verifies all decks)")
+	checkSource := flag.Bool("check-source", false, "also re-download the official deck images and re-upload decks whose source image has changed")
+	dryRun := flag.Bool("dry-run", false, "report broken images without re-uploading them")
+	flag.Parse()
+
+	if err := logging.Setup(cfg.Log.Format, cfg.Log.Level); err != nil {
+		slog.Error("Invalid log configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	if err := errors.Join(cfg.DB.Validate(), cfg.Storage.Validate(), cfg.API.ValidateResults()); err != nil {
+		slog.Error("Invalid configuration", logging.Err(err))
+		os.Exit(1)
+	}
+
+	if *sample < 0 {
+		slog.Error("Invalid -sample", "sample", *sample)
+		os.Exit(1)
+	}
+
+	renditions, err := deckimage.ParseRenditions(cfg.DeckImage.Renditions)
+	if err != nil {
+		slog.Error("Invalid deck image renditions", logging.Err(err))
+		os.Exit(1)
+	}
+
+	db, err := postgres.NewDB(cfg.DB.Hostname, cfg.DB.Port, cfg.DB.UserName, cfg.DB.UserPassword, cfg.DB.Name)
+	if err != nil {
+		slog.Error("Failed to connect database", logging.Err(err))
+		os.Exit(1)
+	}
+
+	var store imagestore.ImageStore
+	switch cfg.Storage.Backend {
+	case config.StorageBackendLocal:
+		store = imagestore.NewLocalImageStore(cfg.Storage.LocalDir)
+	default:
+		store, err = imagestore.NewS3ImageStore(context.Background(), cfg.Storage.Endpoint, cfg.Storage.Bucket)
+		if err != nil {
+			slog.Error("Failed to load default aws config", logging.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	ctx := context.Background()
+	imageRepo := postgres.NewDeckImageRepository(db)
+	pipeline := deckimage.NewPipeline(store, imageRepo, cfg.API.DeckBaseURL, renditions, cfg.DeckImage.CacheControl)
+
+	dis, err := imageRepo.FindAll(ctx)
+	if err != nil {
+		slog.Error("Failed to list deck images", logging.Err(err))
+		os.Exit(1)
+	}
+
+	var deckCodes []string
+	byDeck := map[string][]*model.DeckImage{}
+	for _, di := range dis {
+		if _, ok := byDeck[di.DeckCode]; !ok {
+			deckCodes = append(deckCodes, di.DeckCode)
+		}
+		byDeck[di.DeckCode] = append(byDeck[di.DeckCode], di)
+	}
+
+	if *sample > 0 && *sample < len(deckCodes) {
+		rand.Shuffle(len(deckCodes), func(i, j int) {
+			deckCodes[i], deckCodes[j] = deckCodes[j], deckCodes[i]
+		})
+		deckCodes = deckCodes[:*sample]
+	}
+
+	counts := map[deckimage.Status]int{}
+	verified := 0
+	changed := 0
+	reuploaded := 0
+	failed := 0
+	for _, deckCode := range deckCodes {
+		broken := false
+		for _, di := range byDeck[deckCode] {
+			status, err := pipeline.Verify(ctx, di)
+			if err != nil {
+				slog.Error("Failed to verify deck image", logging.KeyDeckCode, deckCode, "key", di.Key, logging.Err(err))
+				failed++
+				continue
+			}
+
+			verified++
+			counts[status]++
+			if status != deckimage.StatusOK {
+				slog.Warn("Deck image is broken", logging.KeyDeckCode, deckCode, "key", di.Key, "status", status)
+				broken = true
+			}
+		}
+
+		if *checkSource && !broken {
+			ok, err := pipeline.SourceChanged(ctx, deckCode, byDeck[deckCode])
+			if err != nil {
+				slog.Error("Failed to check source image of deck", logging.KeyDeckCode, deckCode, logging.Err(err))
+				failed++
+				continue
+			}
+
+			if ok {
+				slog.Warn("Source image of deck changed", logging.KeyDeckCode, deckCode)
+				changed++
+				broken = true
+			}
+		}
+
+		if !broken || *dryRun {
+			continue
+		}
+
+		n, err := pipeline.Reupload(ctx, deckCode)
+		if err != nil {
+			slog.Error("Failed to re-upload images of deck", logging.KeyDeckCode, deckCode, logging.Err(err))
+			failed++
+			continue
+		}
+		reuploaded += n
+	}
+
+	slog.Info("Verified deck images",
+		"images", verified,
+		"decks", len(deckCodes),
+		"ok", counts[deckimage.StatusOK],
+		"missing", counts[deckimage.StatusMissing],
+		"corrupted", counts[deckimage.StatusCorrupted],
+		"source_changed", changed,
+	)
+
+	if *dryRun {
+		slog.Info("Dry run, nothing re-uploaded")
+	} else {
+		slog.Info("Re-uploaded deck images", "images", reuploaded)
+	}
+
+	if failed > 0 {
+		slog.Error("Errors occurred", "errors", failed)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
@@ -0,0 +1,168 @@
+package archetype
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+)
+
+// どのアーキタイプにも該当しないデッキ
+const Unclassified = ""
+
+// アーキタイプの判定ルール
+// archetypes は上から順に評価し、最初にすべての条件を満たしたものを採用する
+type Rules struct {
+	Archetypes []*Archetype `json:"archetypes"`
+}
+
+type Archetype struct {
+	Id         string       `json:"id"`
+	Name       string       `json:"name"`
+	Conditions []*Condition `json:"conditions"`
+}
+
+// カード名またはカードIDで指定したカードの合計枚数が min 以上 max 以下であること
+// min を省略した場合は1枚以上、max を省略した場合は上限なし
+// max に 0 を指定すると「採用していないこと」を表す
+type Condition struct {
+	Name     string `json:"name,omitempty"`
+	CardId   string `json:"card_id,omitempty"`
+	Category string `json:"category,omitempty"`
+	Min      *uint  `json:"min,omitempty"`
+	Max      *uint  `json:"max,omitempty"`
+}
+
+func (c *Condition) matches(card *model.DeckCard) bool {
+	if c.Name != "" && c.Name != card.Name {
+		return false
+	}
+
+	if c.CardId != "" && c.CardId != card.CardId {
+		return false
+	}
+
+	if c.Category != "" && c.Category != card.Category {
+		return false
+	}
+
+	return true
+}
+
+func (c *Condition) satisfied(cards []*model.DeckCard) bool {
+	var count uint
+	for _, card := range cards {
+		if c.matches(card) {
+			count += card.Count
+		}
+	}
+
+	min := uint(1)
+	if c.Min != nil {
+		min = *c.Min
+	}
+
+	if c.Max != nil {
+		// max が 0 の場合は「採用していないこと」のみを条件にする
+		if *c.Max == 0 {
+			return count == 0
+		}
+		if count > *c.Max {
+			return false
+		}
+	}
+
+	return count >= min
+}
+
+func (r *Rules) Validate() error {
+	var errs []error
+
+	seen := map[string]struct{}{}
+	for i, a := range r.Archetypes {
+		if a.Id == "" {
+			errs = append(errs, fmt.Errorf("archetypes[%d]: id is required", i))
+			continue
+		}
+
+		if _, ok := seen[a.Id]; ok {
+			errs = append(errs, fmt.Errorf("archetypes[%d]: duplicate id %q", i, a.Id))
+		}
+		seen[a.Id] = struct{}{}
+
+		if len(a.Conditions) == 0 {
+			errs = append(errs, fmt.Errorf("archetype %q: at least one condition is required", a.Id))
+		}
+
+		for j, c := range a.Conditions {
+			if c.Name == "" && c.CardId == "" {
+				errs = append(errs, fmt.Errorf("archetype %q: conditions[%d]: name or card_id is required", a.Id, j))
+			}
+
+			if c.Min != nil && c.Max != nil && *c.Max != 0 && *c.Min > *c.Max {
+				errs = append(errs, fmt.Errorf("archetype %q: conditions[%d]: min is greater than max", a.Id, j))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+type Classifier struct {
+	rules *Rules
+}
+
+func NewClassifier(rules *Rules) (*Classifier, error) {
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Classifier{
+		rules: rules,
+	}, nil
+}
+
+// JSON のルールファイルを読み込む
+func LoadClassifier(path string) (*Classifier, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules Rules
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	c, err := NewClassifier(&rules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// デッキのカード構成からアーキタイプのIDを返す
+func (c *Classifier) Classify(cards []*model.DeckCard) string {
+	if len(cards) == 0 {
+		return Unclassified
+	}
+
+	for _, a := range c.rules.Archetypes {
+		matched := true
+		for _, cond := range a.Conditions {
+			if !cond.satisfied(cards) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return a.Id
+		}
+	}
+
+	return Unclassified
+}
@@ -0,0 +1,217 @@
+package archetype
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+)
+
+func uintPtr(v uint) *uint {
+	return &v
+}
+
+func card(category string, cardId string, name string, count uint) *model.DeckCard {
+	return model.NewDeckCard("deck", category, cardId, name, count)
+}
+
+func TestConditionSatisfied(t *testing.T) {
+	cards := []*model.DeckCard{
+		card("pokemon", "47013", "リザードンex", 2),
+		// 同じカード名で別のカードIDのものは合計する
+		card("pokemon", "46510", "リザードンex", 1),
+		card("pokemon", "46517", "ピジョットex", 1),
+		card("goods", "44997", "ふしぎなアメ", 4),
+	}
+
+	cases := []struct {
+		name string
+		cond *Condition
+		want bool
+	}{
+		{"omitted min defaults to 1", &Condition{Name: "ピジョットex"}, true},
+		{"omitted min with absent card", &Condition{Name: "キュワワー"}, false},
+		{"counts are summed by name", &Condition{Name: "リザードンex", Min: uintPtr(3)}, true},
+		{"below min", &Condition{Name: "リザードンex", Min: uintPtr(4)}, false},
+		{"by card id", &Condition{CardId: "47013", Min: uintPtr(2)}, true},
+		{"by card id below min", &Condition{CardId: "46510", Min: uintPtr(2)}, false},
+		{"within max", &Condition{Name: "ふしぎなアメ", Max: uintPtr(4)}, true},
+		{"above max", &Condition{Name: "ふしぎなアメ", Max: uintPtr(3)}, false},
+		{"max 0 with absent card", &Condition{Name: "キュワワー", Max: uintPtr(0)}, true},
+		{"max 0 with present card", &Condition{Name: "ピジョットex", Max: uintPtr(0)}, false},
+		// max が 0 の場合は min を見ない
+		{"max 0 ignores min", &Condition{Name: "キュワワー", Min: uintPtr(1), Max: uintPtr(0)}, true},
+		{"category matches", &Condition{Name: "ふしぎなアメ", Category: "goods"}, true},
+		{"category does not match", &Condition{Name: "ふしぎなアメ", Category: "pokemon"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.cond.satisfied(cards); got != tc.want {
+				t.Errorf("satisfied = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRulesValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		rules   *Rules
+		wantErr bool
+	}{
+		{
+			"valid",
+			&Rules{Archetypes: []*Archetype{
+				{Id: "a", Conditions: []*Condition{{Name: "リザードンex", Min: uintPtr(2), Max: uintPtr(3)}}},
+				{Id: "b", Conditions: []*Condition{{CardId: "47013", Min: uintPtr(1), Max: uintPtr(0)}}},
+			}},
+			false,
+		},
+		{"no archetypes", &Rules{}, false},
+		{
+			"missing id",
+			&Rules{Archetypes: []*Archetype{{Conditions: []*Condition{{Name: "リザードンex"}}}}},
+			true,
+		},
+		{
+			"duplicate id",
+			&Rules{Archetypes: []*Archetype{
+				{Id: "a", Conditions: []*Condition{{Name: "リザードンex"}}},
+				{Id: "a", Conditions: []*Condition{{Name: "ピジョットex"}}},
+			}},
+			true,
+		},
+		{
+			"no conditions",
+			&Rules{Archetypes: []*Archetype{{Id: "a"}}},
+			true,
+		},
+		{
+			"condition without name or card id",
+			&Rules{Archetypes: []*Archetype{{Id: "a", Conditions: []*Condition{{Category: "pokemon"}}}}},
+			true,
+		},
+		{
+			"min greater than max",
+			&Rules{Archetypes: []*Archetype{{Id: "a", Conditions: []*Condition{{Name: "リザードンex", Min: uintPtr(3), Max: uintPtr(2)}}}}},
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.rules.Validate()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Validate = %v, wantErr %v", err, tc.wantErr)
+			}
+
+			if _, err := NewClassifier(tc.rules); (err != nil) != tc.wantErr {
+				t.Errorf("NewClassifier = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	c, err := NewClassifier(&Rules{Archetypes: []*Archetype{
+		{Id: "charizard-pidgeot", Conditions: []*Condition{{Name: "リザードンex", Min: uintPtr(2)}, {Name: "ピジョットex"}}},
+		{Id: "charizard", Conditions: []*Condition{{Name: "リザードンex", Min: uintPtr(2)}}},
+		{Id: "charizard-no-pidgeot", Conditions: []*Condition{{Name: "リザードンex"}, {Name: "ピジョットex", Max: uintPtr(0)}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name  string
+		cards []*model.DeckCard
+		want  string
+	}{
+		{
+			"all conditions of the first archetype",
+			[]*model.DeckCard{card("pokemon", "47013", "リザードンex", 2), card("pokemon", "46517", "ピジョットex", 1)},
+			"charizard-pidgeot",
+		},
+		{
+			// charizard-no-pidgeot も満たすが、先に書いた charizard を採用する
+			"first matching archetype wins",
+			[]*model.DeckCard{card("pokemon", "47013", "リザードンex", 3)},
+			"charizard",
+		},
+		{
+			"later archetype",
+			[]*model.DeckCard{card("pokemon", "47013", "リザードンex", 1)},
+			"charizard-no-pidgeot",
+		},
+		{
+			"no archetype",
+			[]*model.DeckCard{card("pokemon", "46517", "ピジョットex", 1)},
+			Unclassified,
+		},
+		{
+			// max が 0 の条件だけなら満たすが、カード構成がないデッキは判定しない
+			"no cards",
+			nil,
+			Unclassified,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := c.Classify(tc.cards); got != tc.want {
+				t.Errorf("Classify = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadClassifierSample(t *testing.T) {
+	c, err := LoadClassifier("../../archetype_rules.sample.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cards := []*model.DeckCard{
+		card("pokemon", "47013", "リザードンex", 3),
+		card("pokemon", "46517", "ピジョットex", 2),
+		card("pokemon", "46512", "ヒトカゲ", 4),
+		card("goods", "44997", "ふしぎなアメ", 4),
+		card("energy", "44000", "基本炎エネルギー", 6),
+	}
+	if got := c.Classify(cards); got != "charizard-ex-pidgeot-ex" {
+		t.Errorf("Classify = %q, want %q", got, "charizard-ex-pidgeot-ex")
+	}
+
+	cards = []*model.DeckCard{
+		card("pokemon", "45006", "キュワワー", 4),
+		card("goods", "45510", "ミラージュゲート", 2),
+	}
+	if got := c.Classify(cards); got != "lost-box" {
+		t.Errorf("Classify = %q, want %q", got, "lost-box")
+	}
+}
+
+func TestLoadClassifierInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"broken.json":  `{"archetypes": [`,
+		"invalid.json": `{"archetypes": [{"id": "a", "conditions": []}]}`,
+	}
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadClassifier(path); err == nil {
+			t.Errorf("LoadClassifier(%s) succeeded, want error", name)
+		}
+	}
+
+	if _, err := LoadClassifier(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("LoadClassifier of a missing file succeeded, want error")
+	}
+}
@@ -0,0 +1,345 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/mackerel"
+)
+
+const (
+	StorageBackendS3    = "s3"
+	StorageBackendLocal = "local"
+
+	DefaultStorageEndpoint = "https://s3.isk01.sakurastorage.jp"
+	DefaultStorageBucket   = "vsrecorder"
+	DefaultResultsBaseURL  = "https://players.pokemon-card.com"
+	DefaultDeckBaseURL     = "https://www.pokemon-card.com"
+	DefaultEventsBaseURL   = "https://beta.vsrecorder.mobi"
+
+	// 既存のフロントエンドが参照している images/decks/{code}.jpg を含める
+	DefaultDeckImageRenditions   = ":jpeg:0:75,thumb:jpeg:320:80,webp:webp:0:0"
+	DefaultDeckImageCacheControl = "public, max-age=604800"
+
+	DefaultMackerelService = "monolith"
+
+	DefaultLogLevel  = "info"
+	DefaultLogFormat = logging.FormatJSON
+)
+
+// 各コマンドの設定
+// 環境変数の値をフラグのデフォルト値とし、フラグで上書きできる
+type Config struct {
+	MQ MQConfig
+	// デッキ画像のアップロードを依頼するキュー
+	DeckImageMQ MQConfig
+	DB          DBConfig
+	Storage     StorageConfig
+	API         APIConfig
+	Archetype   ArchetypeConfig
+	DeckImage   DeckImageConfig
+	Metrics     MetricsConfig
+	Mackerel    MackerelConfig
+	Log         LogConfig
+}
+
+type MQConfig struct {
+	BaseURL string
+	Name    string
+	Token   string
+	File    string
+
+	// 環境変数とフラグの名前の接頭辞 (MQ_ と mq- など)
+	envPrefix  string
+	flagPrefix string
+}
+
+type DBConfig struct {
+	Hostname     string
+	Port         string
+	UserName     string
+	UserPassword string
+	Name         string
+}
+
+type StorageConfig struct {
+	Backend  string
+	Endpoint string
+	Bucket   string
+	LocalDir string
+}
+
+type APIConfig struct {
+	EventsBaseURL  string
+	ResultsBaseURL string
+	DeckBaseURL    string
+}
+
+// デッキ画像の出力形式 (deckimage.ParseRenditions の書式) と Cache-Control
+type DeckImageConfig struct {
+	Renditions   string
+	CacheControl string
+}
+
+// メトリクスの出力先
+// どちらも空の場合は出力しない
+type MetricsConfig struct {
+	// node_exporter の textfile collector が読むディレクトリ
+	TextfileDir string
+	// Pushgateway の URL
+	PushURL string
+}
+
+// Mackerel のサービスメトリックの送信先
+// Sink が空の場合は送らない
+type MackerelConfig struct {
+	// stdout, file, http のいずれか
+	Sink    string
+	Service string
+	File    string
+	BaseURL string
+	APIKey  string
+}
+
+// 値は logging.Setup で検証する
+type LogConfig struct {
+	// debug, info, warn, error のいずれか
+	Level string
+	// json または text
+	Format string
+}
+
+type ArchetypeConfig struct {
+	RulesFile string
+}
+
+func getenv(key, defaultValue string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return defaultValue
+}
+
+func mqFromEnv(envPrefix, flagPrefix, defaultBaseURL string) MQConfig {
+	return MQConfig{
+		BaseURL:    getenv(envPrefix+"BASE_URL", defaultBaseURL),
+		Name:       os.Getenv(envPrefix + "NAME"),
+		Token:      os.Getenv(envPrefix + "TOKEN"),
+		File:       os.Getenv(envPrefix + "FILE"),
+		envPrefix:  envPrefix,
+		flagPrefix: flagPrefix,
+	}
+}
+
+func FromEnv() *Config {
+	mq := mqFromEnv("MQ_", "mq-", simplemq.DefaultBaseURL)
+
+	return &Config{
+		MQ: mq,
+		// 接続先は取り込み用のキューと同じものをデフォルトにする
+		DeckImageMQ: mqFromEnv("DECK_IMAGE_MQ_", "deck-image-mq-", mq.BaseURL),
+		DB: DBConfig{
+			Hostname:     os.Getenv("DB_HOSTNAME"),
+			Port:         os.Getenv("DB_PORT"),
+			UserName:     os.Getenv("DB_USER_NAME"),
+			UserPassword: os.Getenv("DB_USER_PASSWORD"),
+			Name:         os.Getenv("DB_NAME"),
+		},
+		Storage: StorageConfig{
+			Backend:  getenv("STORAGE_BACKEND", StorageBackendS3),
+			Endpoint: getenv("STORAGE_ENDPOINT", DefaultStorageEndpoint),
+			Bucket:   getenv("STORAGE_BUCKET", DefaultStorageBucket),
+			LocalDir: os.Getenv("STORAGE_LOCAL_DIR"),
+		},
+		API: APIConfig{
+			EventsBaseURL:  getenv("EVENTS_BASE_URL", DefaultEventsBaseURL),
+			ResultsBaseURL: getenv("RESULTS_BASE_URL", DefaultResultsBaseURL),
+			DeckBaseURL:    getenv("DECK_BASE_URL", DefaultDeckBaseURL),
+		},
+		Archetype: ArchetypeConfig{
+			RulesFile: os.Getenv("ARCHETYPE_RULES_FILE"),
+		},
+		DeckImage: DeckImageConfig{
+			Renditions:   getenv("DECK_IMAGE_RENDITIONS", DefaultDeckImageRenditions),
+			CacheControl: getenv("DECK_IMAGE_CACHE_CONTROL", DefaultDeckImageCacheControl),
+		},
+		Metrics: MetricsConfig{
+			TextfileDir: os.Getenv("METRICS_TEXTFILE_DIR"),
+			PushURL:     os.Getenv("METRICS_PUSH_URL"),
+		},
+		Mackerel: MackerelConfig{
+			Sink:    os.Getenv("MACKEREL_SINK"),
+			Service: getenv("MACKEREL_SERVICE", DefaultMackerelService),
+			File:    os.Getenv("MACKEREL_FILE"),
+			BaseURL: getenv("MACKEREL_BASE_URL", mackerel.DefaultBaseURL),
+			APIKey:  os.Getenv("MACKEREL_API_KEY"),
+		},
+		Log: LogConfig{
+			Level:  getenv("LOG_LEVEL", DefaultLogLevel),
+			Format: getenv("LOG_FORMAT", DefaultLogFormat),
+		},
+	}
+}
+
+func validateURL(name, v string) error {
+	u, err := url.Parse(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s: %q is not an absolute http(s) URL", name, v)
+	}
+
+	return nil
+}
+
+func required(name, v string) error {
+	if v == "" {
+		return fmt.Errorf("%s is required", name)
+	}
+
+	return nil
+}
+
+func (c *MQConfig) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.BaseURL, c.flagPrefix+"base-url", c.BaseURL, fmt.Sprintf("SimpleMQ API base URL (env: %sBASE_URL)", c.envPrefix))
+	fs.StringVar(&c.Name, c.flagPrefix+"name", c.Name, fmt.Sprintf("SimpleMQ queue name (env: %sNAME)", c.envPrefix))
+	fs.StringVar(&c.File, c.flagPrefix+"file", c.File, fmt.Sprintf("use a local file-backed queue at this path instead of SimpleMQ (env: %sFILE)", c.envPrefix))
+}
+
+func (c *MQConfig) Validate() error {
+	// ファイルキューを使う場合は SimpleMQ の設定は不要
+	if c.File != "" {
+		return nil
+	}
+
+	return errors.Join(
+		validateURL(c.envPrefix+"BASE_URL", c.BaseURL),
+		required(c.envPrefix+"NAME", c.Name),
+		required(c.envPrefix+"TOKEN", c.Token),
+	)
+}
+
+func (c *DBConfig) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Hostname, "db-hostname", c.Hostname, "database hostname (env: DB_HOSTNAME)")
+	fs.StringVar(&c.Port, "db-port", c.Port, "database port (env: DB_PORT)")
+	fs.StringVar(&c.Name, "db-name", c.Name, "database name (env: DB_NAME)")
+}
+
+func (c *DBConfig) Validate() error {
+	return errors.Join(
+		required("DB_HOSTNAME", c.Hostname),
+		required("DB_PORT", c.Port),
+		required("DB_USER_NAME", c.UserName),
+		required("DB_NAME", c.Name),
+	)
+}
+
+func (c *StorageConfig) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Backend, "storage-backend", c.Backend, "where deck images are stored: s3 or local (env: STORAGE_BACKEND)")
+	fs.StringVar(&c.LocalDir, "storage-local-dir", c.LocalDir, "directory deck images are stored in when -storage-backend=local (env: STORAGE_LOCAL_DIR)")
+	fs.StringVar(&c.Endpoint, "storage-endpoint", c.Endpoint, "S3 compatible object storage endpoint (env: STORAGE_ENDPOINT)")
+	fs.StringVar(&c.Bucket, "storage-bucket", c.Bucket, "bucket deck images are stored in (env: STORAGE_BUCKET)")
+}
+
+func (c *StorageConfig) Validate() error {
+	switch c.Backend {
+	case StorageBackendS3:
+		return errors.Join(
+			validateURL("STORAGE_ENDPOINT", c.Endpoint),
+			required("STORAGE_BUCKET", c.Bucket),
+		)
+	case StorageBackendLocal:
+		return required("STORAGE_LOCAL_DIR", c.LocalDir)
+	default:
+		return fmt.Errorf("STORAGE_BACKEND: unknown backend %q", c.Backend)
+	}
+}
+
+func (c *APIConfig) RegisterEventsFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.EventsBaseURL, "events-base-url", c.EventsBaseURL, "official events API base URL (env: EVENTS_BASE_URL)")
+}
+
+func (c *APIConfig) ValidateEvents() error {
+	return validateURL("EVENTS_BASE_URL", c.EventsBaseURL)
+}
+
+func (c *APIConfig) RegisterResultsFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ResultsBaseURL, "results-base-url", c.ResultsBaseURL, "official event results base URL (env: RESULTS_BASE_URL)")
+	fs.StringVar(&c.DeckBaseURL, "deck-base-url", c.DeckBaseURL, "official deck page base URL (env: DECK_BASE_URL)")
+}
+
+func (c *APIConfig) ValidateResults() error {
+	return errors.Join(
+		validateURL("RESULTS_BASE_URL", c.ResultsBaseURL),
+		validateURL("DECK_BASE_URL", c.DeckBaseURL),
+	)
+}
+
+func (c *ArchetypeConfig) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.RulesFile, "archetype-rules-file", c.RulesFile, "JSON file of deck archetype rules (env: ARCHETYPE_RULES_FILE)")
+}
+
+// 判定ルールを必須とするコマンド向けの検証
+func (c *ArchetypeConfig) Validate() error {
+	return required("ARCHETYPE_RULES_FILE", c.RulesFile)
+}
+
+func (c *DeckImageConfig) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Renditions, "deck-image-renditions", c.Renditions, "comma-separated deck image renditions as {name}:{format}:{width}:{quality} (env: DECK_IMAGE_RENDITIONS)")
+	fs.StringVar(&c.CacheControl, "deck-image-cache-control", c.CacheControl, "Cache-Control of uploaded deck images (env: DECK_IMAGE_CACHE_CONTROL)")
+}
+
+func (c *MetricsConfig) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.TextfileDir, "metrics-textfile-dir", c.TextfileDir, "write metrics for the node_exporter textfile collector into this directory (env: METRICS_TEXTFILE_DIR)")
+	fs.StringVar(&c.PushURL, "metrics-push-url", c.PushURL, "push metrics to the Pushgateway at this URL (env: METRICS_PUSH_URL)")
+}
+
+func (c *MetricsConfig) Validate() error {
+	if c.PushURL == "" {
+		return nil
+	}
+
+	return validateURL("METRICS_PUSH_URL", c.PushURL)
+}
+
+func (c *MackerelConfig) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Sink, "mackerel-sink", c.Sink, "where Mackerel service metrics are sent: stdout, file or http (env: MACKEREL_SINK)")
+	fs.StringVar(&c.Service, "mackerel-service", c.Service, "Mackerel service name (env: MACKEREL_SERVICE)")
+	fs.StringVar(&c.File, "mackerel-file", c.File, "file Mackerel service metrics are appended to when -mackerel-sink=file (env: MACKEREL_FILE)")
+	fs.StringVar(&c.BaseURL, "mackerel-base-url", c.BaseURL, "Mackerel API base URL when -mackerel-sink=http (env: MACKEREL_BASE_URL)")
+}
+
+func (c *MackerelConfig) Validate() error {
+	switch c.Sink {
+	case "":
+		return nil
+	case mackerel.SinkStdout:
+		return required("MACKEREL_SERVICE", c.Service)
+	case mackerel.SinkFile:
+		return errors.Join(
+			required("MACKEREL_SERVICE", c.Service),
+			required("MACKEREL_FILE", c.File),
+		)
+	case mackerel.SinkHTTP:
+		return errors.Join(
+			required("MACKEREL_SERVICE", c.Service),
+			validateURL("MACKEREL_BASE_URL", c.BaseURL),
+			required("MACKEREL_API_KEY", c.APIKey),
+		)
+	default:
+		return fmt.Errorf("MACKEREL_SINK: unknown sink %q", c.Sink)
+	}
+}
+
+func (c *LogConfig) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Level, "log-level", c.Level, "minimum log level: debug, info, warn or error (env: LOG_LEVEL)")
+	fs.StringVar(&c.Format, "log-format", c.Format, "log format: json or text (env: LOG_FORMAT)")
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+)
+
+func TestFromEnvMQ(t *testing.T) {
+	// 空の値は未設定として扱われる
+	t.Setenv("MQ_BASE_URL", "")
+	if got := FromEnv().MQ.BaseURL; got != simplemq.DefaultBaseURL {
+		t.Errorf("MQ.BaseURL = %s, want %s", got, simplemq.DefaultBaseURL)
+	}
+
+	t.Setenv("MQ_BASE_URL", "http://127.0.0.1:8080")
+	if got := FromEnv().MQ.BaseURL; got != "http://127.0.0.1:8080" {
+		t.Errorf("MQ.BaseURL = %s, want http://127.0.0.1:8080", got)
+	}
+}
+
+func TestFromEnvDeckImageMQ(t *testing.T) {
+	t.Setenv("MQ_BASE_URL", "http://127.0.0.1:8080")
+	t.Setenv("MQ_NAME", "import")
+	t.Setenv("MQ_TOKEN", "token")
+	t.Setenv("DECK_IMAGE_MQ_BASE_URL", "")
+	t.Setenv("DECK_IMAGE_MQ_NAME", "")
+	t.Setenv("DECK_IMAGE_MQ_TOKEN", "token")
+	t.Setenv("DECK_IMAGE_MQ_FILE", "")
+
+	cfg := FromEnv()
+
+	// 接続先は取り込み用のキューに合わせる
+	if cfg.DeckImageMQ.BaseURL != "http://127.0.0.1:8080" {
+		t.Errorf("DeckImageMQ.BaseURL = %s, want http://127.0.0.1:8080", cfg.DeckImageMQ.BaseURL)
+	}
+
+	// キュー名は引き継がず、エラーには DECK_IMAGE_MQ_ の名前が出る
+	err := cfg.DeckImageMQ.Validate()
+	if err == nil || !strings.Contains(err.Error(), "DECK_IMAGE_MQ_NAME") {
+		t.Errorf("DeckImageMQ.Validate() error = %v, want DECK_IMAGE_MQ_NAME is required", err)
+	}
+
+	t.Setenv("DECK_IMAGE_MQ_BASE_URL", "http://127.0.0.1:8081")
+	if got := FromEnv().DeckImageMQ.BaseURL; got != "http://127.0.0.1:8081" {
+		t.Errorf("DeckImageMQ.BaseURL = %s, want http://127.0.0.1:8081", got)
+	}
+}
+
+func TestMQConfigRegisterFlags(t *testing.T) {
+	t.Setenv("MQ_NAME", "from-env")
+	t.Setenv("MQ_FILE", "")
+	t.Setenv("DECK_IMAGE_MQ_NAME", "deck-images-from-env")
+
+	cfg := FromEnv()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.MQ.RegisterFlags(fs)
+	cfg.DeckImageMQ.RegisterFlags(fs)
+
+	if err := fs.Parse([]string{"-mq-name", "from-flag", "-deck-image-mq-file", "./local.mq"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.MQ.Name != "from-flag" {
+		t.Errorf("MQ.Name = %s, want from-flag", cfg.MQ.Name)
+	}
+	if cfg.MQ.File != "" {
+		t.Errorf("MQ.File = %s, want empty", cfg.MQ.File)
+	}
+	if cfg.DeckImageMQ.Name != "deck-images-from-env" {
+		t.Errorf("DeckImageMQ.Name = %s, want deck-images-from-env", cfg.DeckImageMQ.Name)
+	}
+	if cfg.DeckImageMQ.File != "./local.mq" {
+		t.Errorf("DeckImageMQ.File = %s, want ./local.mq", cfg.DeckImageMQ.File)
+	}
+}
+
+func TestMQConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     MQConfig
+		wantErr bool
+	}{
+		{"simplemq", MQConfig{BaseURL: "https://simplemq.example.com", Name: "queue", Token: "token"}, false},
+		{"file queue needs nothing else", MQConfig{File: "./local.mq"}, false},
+		{"missing token", MQConfig{BaseURL: "https://simplemq.example.com", Name: "queue"}, true},
+		{"relative base URL", MQConfig{BaseURL: "127.0.0.1:8080", Name: "queue", Token: "token"}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestStorageConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     StorageConfig
+		wantErr bool
+	}{
+		{"s3", StorageConfig{Backend: StorageBackendS3, Endpoint: DefaultStorageEndpoint, Bucket: DefaultStorageBucket}, false},
+		{"s3 without bucket", StorageConfig{Backend: StorageBackendS3, Endpoint: DefaultStorageEndpoint}, true},
+		{"local", StorageConfig{Backend: StorageBackendLocal, LocalDir: "./images"}, false},
+		{"local without dir", StorageConfig{Backend: StorageBackendLocal}, true},
+		{"unknown backend", StorageConfig{Backend: "gcs"}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMackerelConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     MackerelConfig
+		wantErr bool
+	}{
+		{"disabled", MackerelConfig{}, false},
+		{"stdout", MackerelConfig{Sink: "stdout", Service: DefaultMackerelService}, false},
+		{"file without path", MackerelConfig{Sink: "file", Service: DefaultMackerelService}, true},
+		{"http", MackerelConfig{Sink: "http", Service: DefaultMackerelService, BaseURL: "https://api.mackerelio.com", APIKey: "key"}, false},
+		{"http without API key", MackerelConfig{Sink: "http", Service: DefaultMackerelService, BaseURL: "https://api.mackerelio.com"}, true},
+		{"unknown sink", MackerelConfig{Sink: "syslog", Service: DefaultMackerelService}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package deckimage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+)
+
+// デッキ画像のアップロード依頼
+// deckimages がキューから受け取って処理する
+type Job struct {
+	DeckCode string `json:"deck_code"`
+}
+
+func EncodeJob(job *Job) (string, error) {
+	v, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(v), nil
+}
+
+func DecodeJob(content string) (*Job, error) {
+	v, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+
+	var job Job
+	if err := json.Unmarshal(v, &job); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if job.DeckCode == "" {
+		return nil, errors.New("deck_code is required")
+	}
+
+	return &job, nil
+}
+
+// デッキコードごとにアップロード依頼をキューに送る
+// 重複したデッキコードと空のデッキコードは送らない
+func Enqueue(ctx context.Context, mqc simplemq.SimpleMQ, deckCodes []string) (int, error) {
+	seen := map[string]struct{}{}
+	sent := 0
+	for _, deckCode := range deckCodes {
+		if deckCode == "" {
+			continue
+		}
+
+		if _, ok := seen[deckCode]; ok {
+			continue
+		}
+		seen[deckCode] = struct{}{}
+
+		content, err := EncodeJob(&Job{DeckCode: deckCode})
+		if err != nil {
+			return sent, err
+		}
+
+		if _, err := mqc.SendMessage(ctx, &simplemq.SendMessageRequest{Content: content}); err != nil {
+			return sent, err
+		}
+
+		sent++
+	}
+
+	return sent, nil
+}
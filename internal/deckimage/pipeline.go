@@ -0,0 +1,288 @@
+package deckimage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/imagestore"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+	_ "golang.org/x/image/webp"
+)
+
+// 公式サイトが応答しなくなっても、アップロードが止まったままにならないようにする
+const fetchTimeout = 30 * time.Second
+
+// 保存済みの画像を検証した結果
+type Status int
+
+const (
+	StatusOK Status = iota
+	// 記録はあるが画像が保存されていない
+	StatusMissing
+	// 画像のハッシュが記録と一致しない
+	StatusCorrupted
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusMissing:
+		return "missing"
+	case StatusCorrupted:
+		return "corrupted"
+	default:
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+}
+
+// 公式サイトのデッキ画像を取得し、指定された形式に変換して保存する
+// 保存した画像のハッシュと寸法は DeckImageRepository に記録する
+type Pipeline struct {
+	store        imagestore.ImageStore
+	images       repository.DeckImageRepository
+	deckBaseURL  string
+	renditions   []*Rendition
+	cacheControl string
+	httpClient   *http.Client
+}
+
+func NewPipeline(store imagestore.ImageStore, images repository.DeckImageRepository, deckBaseURL string, renditions []*Rendition, cacheControl string) *Pipeline {
+	return &Pipeline{
+		store:        store,
+		images:       images,
+		deckBaseURL:  strings.TrimSuffix(deckBaseURL, "/"),
+		renditions:   renditions,
+		cacheControl: cacheControl,
+		httpClient:   &http.Client{Timeout: fetchTimeout},
+	}
+}
+
+func (p *Pipeline) Renditions() []*Rendition {
+	return p.renditions
+}
+
+func (p *Pipeline) fetch(ctx context.Context, deckCode string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/deck/deckView.php/deckID/%s.png", p.deckBaseURL, deckCode),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+func hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// 画像の本体からハッシュと寸法を求めて記録を作る
+func newDeckImage(key string, deckCode string, r *Rendition, body []byte, sourceSha256 string) (*model.DeckImage, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+
+	return model.NewDeckImage(
+		key,
+		deckCode,
+		r.Name,
+		r.ContentType(),
+		hash(body),
+		int64(len(body)),
+		cfg.Width,
+		cfg.Height,
+		sourceSha256,
+		time.Now(),
+	), nil
+}
+
+// 記録のない保存済みの画像から記録を作る
+// 途中で途切れたアップロードはヘッダだけでは見分けられないので、最後までデコードできた場合だけ採用する
+func newStoredDeckImage(key string, deckCode string, r *Rendition, body []byte) (*model.DeckImage, error) {
+	img, format, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+
+	if format != r.Format {
+		return nil, fmt.Errorf("%s is %s, not %s", key, format, r.Format)
+	}
+
+	b := img.Bounds()
+
+	return model.NewDeckImage(
+		key,
+		deckCode,
+		r.Name,
+		r.ContentType(),
+		hash(body),
+		int64(len(body)),
+		b.Dx(),
+		b.Dy(),
+		"",
+		time.Now(),
+	), nil
+}
+
+// 公式サイトから画像を取得し直して renditions の形式をすべてアップロードする
+func (p *Pipeline) upload(ctx context.Context, deckCode string, renditions []*Rendition) (int, error) {
+	src, err := p.fetch(ctx, deckCode)
+	if err != nil {
+		return 0, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return 0, err
+	}
+	sourceSha256 := hash(src)
+
+	uploaded := 0
+	for _, r := range renditions {
+		key := r.Key(deckCode)
+
+		b, err := r.Render(img)
+		if err != nil {
+			return uploaded, fmt.Errorf("failed to render %s: %w", key, err)
+		}
+
+		di, err := newDeckImage(key, deckCode, r, b, sourceSha256)
+		if err != nil {
+			return uploaded, err
+		}
+
+		if err := p.store.Put(ctx, key, b, imagestore.Metadata{
+			ContentType:  r.ContentType(),
+			CacheControl: p.cacheControl,
+		}); err != nil {
+			return uploaded, err
+		}
+
+		if err := p.images.Save(ctx, di); err != nil {
+			return uploaded, err
+		}
+
+		uploaded++
+	}
+
+	return uploaded, nil
+}
+
+// 保存されていない形式だけを作成してアップロードし、アップロードした数を返す
+// 保存済みでハッシュが記録されていない画像は、最後までデコードできればそのハッシュを記録し、できなければ作り直す
+func (p *Pipeline) Upload(ctx context.Context, deckCode string) (int, error) {
+	var missing []*Rendition
+	for _, r := range p.renditions {
+		key := r.Key(deckCode)
+
+		exists, err := p.store.Exists(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+
+		if !exists {
+			missing = append(missing, r)
+			continue
+		}
+
+		if _, err := p.images.FindByKey(ctx, key); err == nil {
+			continue
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return 0, err
+		}
+
+		b, err := p.store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+
+		di, err := newStoredDeckImage(key, deckCode, r, b)
+		if err != nil {
+			// 壊れている画像は作り直す
+			slog.Warn("Stored deck image is broken, re-uploading it", logging.KeyDeckCode, deckCode, "key", key, logging.Err(err))
+			missing = append(missing, r)
+			continue
+		}
+
+		if err := p.images.Save(ctx, di); err != nil {
+			return 0, err
+		}
+	}
+
+	// すでにアップロードされている場合はスキップする
+	if len(missing) == 0 {
+		return 0, nil
+	}
+
+	return p.upload(ctx, deckCode, missing)
+}
+
+// 公式サイトから画像を取得し直して、すべての形式をアップロードし直す
+func (p *Pipeline) Reupload(ctx context.Context, deckCode string) (int, error) {
+	return p.upload(ctx, deckCode, p.renditions)
+}
+
+// 保存済みの画像をダウンロードして記録したハッシュと比較する
+// 一致した場合は検証日時を記録する
+func (p *Pipeline) Verify(ctx context.Context, di *model.DeckImage) (Status, error) {
+	b, err := p.store.Get(ctx, di.Key)
+	if errors.Is(err, imagestore.ErrNotFound) {
+		return StatusMissing, nil
+	} else if err != nil {
+		return StatusOK, err
+	}
+
+	if int64(len(b)) != di.Size || hash(b) != di.Sha256 {
+		return StatusCorrupted, nil
+	}
+
+	if err := p.images.MarkVerified(ctx, di.Key, time.Now()); err != nil {
+		return StatusOK, err
+	}
+
+	return StatusOK, nil
+}
+
+// 公式サイトの画像が記録時から変わっているかを返す
+// 変換元のハッシュが記録されていない画像は比較しない
+func (p *Pipeline) SourceChanged(ctx context.Context, deckCode string, dis []*model.DeckImage) (bool, error) {
+	src, err := p.fetch(ctx, deckCode)
+	if err != nil {
+		return false, err
+	}
+
+	sourceSha256 := hash(src)
+	for _, di := range dis {
+		if di.SourceSha256 != "" && di.SourceSha256 != sourceSha256 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,395 @@
+package deckimage
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/imagestore"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/memory"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+const testDeckCode = "kVvkkF-abc123-FFkV1F"
+
+func encodePNG(t *testing.T, c color.Color) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// 公式サイトのデッキ画像を返すサーバー
+type deckServer struct {
+	mu       sync.Mutex
+	body     []byte
+	requests int
+}
+
+func (s *deckServer) setBody(body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.body = body
+}
+
+func (s *deckServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+func (s *deckServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if r.URL.Path != "/deck/deckView.php/deckID/"+testDeckCode+".png" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(s.body)
+}
+
+type pipelineFixture struct {
+	server *deckServer
+	store  imagestore.ImageStore
+	images repository.DeckImageRepository
+	p      *Pipeline
+}
+
+func newPipelineFixture(t *testing.T) *pipelineFixture {
+	t.Helper()
+
+	renditions, err := ParseRenditions(":jpeg:0:75,thumb:png:32:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &deckServer{body: encodePNG(t, color.RGBA{R: 200, A: 255})}
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	f := &pipelineFixture{
+		server: server,
+		store:  imagestore.NewLocalImageStore(t.TempDir()),
+		images: memory.NewDeckImageRepository(),
+	}
+	f.p = NewPipeline(f.store, f.images, ts.URL, renditions, "public, max-age=86400")
+
+	return f
+}
+
+func (f *pipelineFixture) record(t *testing.T, key string) *model.DeckImage {
+	t.Helper()
+
+	di, err := f.images.FindByKey(context.Background(), key)
+	if err != nil {
+		t.Fatalf("FindByKey(%s): %v", key, err)
+	}
+
+	return di
+}
+
+func TestPipelineUpload(t *testing.T) {
+	f := newPipelineFixture(t)
+	ctx := context.Background()
+
+	n, err := f.p.Upload(ctx, testDeckCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("uploaded = %d, want 2", n)
+	}
+
+	sourceSha256 := hash(f.server.body)
+	for _, r := range f.p.Renditions() {
+		key := r.Key(testDeckCode)
+
+		b, err := f.store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", key, err)
+		}
+
+		di := f.record(t, key)
+		if di.Sha256 != hash(b) || di.Size != int64(len(b)) || di.SourceSha256 != sourceSha256 || di.ContentType != r.ContentType() {
+			t.Errorf("record of %s = %+v, does not match the stored image", key, di)
+		}
+	}
+
+	thumb := f.record(t, "images/decks/thumb/"+testDeckCode+".png")
+	if thumb.Width != 32 || thumb.Height != 24 {
+		t.Errorf("thumb size = %dx%d, want 32x24", thumb.Width, thumb.Height)
+	}
+
+	// すべて保存済みなら公式サイトから取得し直さない
+	requests := f.server.count()
+	n, err = f.p.Upload(ctx, testDeckCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 || f.server.count() != requests {
+		t.Errorf("second upload = %d with %d requests, want 0 with none", n, f.server.count()-requests)
+	}
+}
+
+func TestPipelineUploadBackfill(t *testing.T) {
+	f := newPipelineFixture(t)
+	ctx := context.Background()
+
+	// 記録のない保存済みの画像
+	img, _, err := image.Decode(bytes.NewReader(f.server.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := map[string][]byte{}
+	for _, r := range f.p.Renditions() {
+		b, err := r.Render(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := r.Key(testDeckCode)
+		if err := f.store.Put(ctx, key, b, imagestore.Metadata{ContentType: r.ContentType()}); err != nil {
+			t.Fatal(err)
+		}
+		stored[key] = b
+	}
+
+	n, err := f.p.Upload(ctx, testDeckCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 || f.server.count() != 0 {
+		t.Errorf("Upload = %d with %d requests, want 0 with none", n, f.server.count())
+	}
+
+	for key, b := range stored {
+		di := f.record(t, key)
+		if di.Sha256 != hash(b) || di.Size != int64(len(b)) {
+			t.Errorf("record of %s = %+v, does not match the stored image", key, di)
+		}
+		// 変換元がわからないので空にする
+		if di.SourceSha256 != "" {
+			t.Errorf("SourceSha256 of %s = %q, want empty", key, di.SourceSha256)
+		}
+	}
+}
+
+func TestPipelineUploadTruncated(t *testing.T) {
+	f := newPipelineFixture(t)
+	ctx := context.Background()
+
+	img, _, err := image.Decode(bytes.NewReader(f.server.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	renditions := f.p.Renditions()
+
+	// 記録のない保存済みの画像のうち、JPEG は途中で途切れている
+	jpegKey := renditions[0].Key(testDeckCode)
+	jpeg, err := renditions[0].Render(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.store.Put(ctx, jpegKey, jpeg[:len(jpeg)/2], imagestore.Metadata{ContentType: "image/jpeg"}); err != nil {
+		t.Fatal(err)
+	}
+
+	thumbKey := renditions[1].Key(testDeckCode)
+	thumb, err := renditions[1].Render(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.store.Put(ctx, thumbKey, thumb, imagestore.Metadata{ContentType: "image/png"}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := f.p.Upload(ctx, testDeckCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 途切れた画像だけを作り直す
+	if n != 1 {
+		t.Errorf("uploaded = %d, want 1", n)
+	}
+
+	b, err := f.store.Get(ctx, jpegKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := image.Decode(bytes.NewReader(b)); err != nil {
+		t.Errorf("re-rendered %s does not decode: %v", jpegKey, err)
+	}
+	if di := f.record(t, jpegKey); di.Sha256 != hash(b) || di.SourceSha256 != hash(f.server.body) {
+		t.Errorf("record of %s = %+v, want the re-rendered image", jpegKey, di)
+	}
+	if di := f.record(t, thumbKey); di.Sha256 != hash(thumb) || di.SourceSha256 != "" {
+		t.Errorf("record of %s = %+v, want the stored image", thumbKey, di)
+	}
+}
+
+func TestPipelineUploadNotFound(t *testing.T) {
+	f := newPipelineFixture(t)
+
+	if _, err := f.p.Upload(context.Background(), "unknown"); err == nil {
+		t.Error("Upload of an unknown deck succeeded, want error")
+	}
+}
+
+func TestNewStoredDeckImage(t *testing.T) {
+	renditions, err := ParseRenditions(":jpeg:0:75,png:png:0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := encodePNG(t, color.RGBA{B: 200, A: 255})
+
+	if _, err := newStoredDeckImage("a.jpg", testDeckCode, renditions[0], body); err == nil {
+		t.Error("newStoredDeckImage of a PNG for a JPEG rendition succeeded, want error")
+	}
+
+	if _, err := newStoredDeckImage("a.png", testDeckCode, renditions[1], body[:len(body)-16]); err == nil {
+		t.Error("newStoredDeckImage of a truncated image succeeded, want error")
+	}
+
+	di, err := newStoredDeckImage("a.png", testDeckCode, renditions[1], body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if di.Width != 64 || di.Height != 48 || di.Sha256 != hash(body) || di.Rendition != "png" {
+		t.Errorf("newStoredDeckImage = %+v", di)
+	}
+}
+
+func TestPipelineVerify(t *testing.T) {
+	f := newPipelineFixture(t)
+	ctx := context.Background()
+
+	if _, err := f.p.Upload(ctx, testDeckCode); err != nil {
+		t.Fatal(err)
+	}
+
+	jpegKey := "images/decks/" + testDeckCode + ".jpg"
+	thumbKey := "images/decks/thumb/" + testDeckCode + ".png"
+
+	status, err := f.p.Verify(ctx, f.record(t, jpegKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != StatusOK {
+		t.Errorf("Verify = %v, want %v", status, StatusOK)
+	}
+	if f.record(t, jpegKey).VerifiedAt == nil {
+		t.Error("VerifiedAt is not recorded")
+	}
+
+	if err := f.store.Put(ctx, jpegKey, []byte("broken"), imagestore.Metadata{ContentType: "image/jpeg"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.store.Delete(ctx, thumbKey); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		key  string
+		want Status
+	}{
+		{jpegKey, StatusCorrupted},
+		{thumbKey, StatusMissing},
+	}
+	for _, tc := range cases {
+		status, err := f.p.Verify(ctx, f.record(t, tc.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != tc.want {
+			t.Errorf("Verify(%s) = %v, want %v", tc.key, status, tc.want)
+		}
+	}
+
+	// 壊れた画像は検証日時を記録しない
+	if f.record(t, thumbKey).VerifiedAt != nil {
+		t.Error("VerifiedAt of the missing image is recorded")
+	}
+}
+
+func TestPipelineSourceChanged(t *testing.T) {
+	f := newPipelineFixture(t)
+	ctx := context.Background()
+
+	if _, err := f.p.Upload(ctx, testDeckCode); err != nil {
+		t.Fatal(err)
+	}
+
+	dis, err := f.images.FindAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := f.p.SourceChanged(ctx, testDeckCode, dis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("SourceChanged = true, want false for the same image")
+	}
+
+	f.server.setBody(encodePNG(t, color.RGBA{G: 200, A: 255}))
+
+	changed, err = f.p.SourceChanged(ctx, testDeckCode, dis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("SourceChanged = false, want true after the image changed")
+	}
+
+	// 変換元のハッシュがない記録は比較しない
+	backfilled := []*model.DeckImage{{Key: dis[0].Key, DeckCode: testDeckCode}}
+	changed, err = f.p.SourceChanged(ctx, testDeckCode, backfilled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("SourceChanged = true, want false without a source hash")
+	}
+
+	if _, err := f.p.SourceChanged(ctx, "unknown", dis); err == nil {
+		t.Error("SourceChanged of an unknown deck succeeded, want error")
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	cases := map[Status]string{
+		StatusOK:        "ok",
+		StatusMissing:   "missing",
+		StatusCorrupted: "corrupted",
+		Status(9):       "Status(9)",
+	}
+	for status, want := range cases {
+		if got := status.String(); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package deckimage
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatWebP = "webp"
+)
+
+// デッキ画像の出力形式
+type Rendition struct {
+	// 保存先のキーに使う名前
+	// 空の場合は images/decks/{code}.{ext} に、それ以外は images/decks/{name}/{code}.{ext} に保存する
+	Name string
+	// jpeg, png, webp のいずれか
+	Format string
+	// 出力する幅 (ピクセル)
+	// 0 または元画像以上の場合は縮小しない
+	Width int
+	// JPEG の品質 (1-100)
+	// 0 の場合はデフォルト値を使う
+	// PNG と WebP (ロスレス) では 0 しか指定できない
+	Quality int
+}
+
+func (r *Rendition) extension() string {
+	if r.Format == FormatJPEG {
+		return "jpg"
+	}
+
+	return r.Format
+}
+
+func (r *Rendition) ContentType() string {
+	return "image/" + r.Format
+}
+
+func (r *Rendition) Key(deckCode string) string {
+	if r.Name == "" {
+		return fmt.Sprintf("images/decks/%s.%s", deckCode, r.extension())
+	}
+
+	return fmt.Sprintf("images/decks/%s/%s.%s", r.Name, deckCode, r.extension())
+}
+
+// "{name}:{format}:{width}:{quality}" をカンマで繋いだ指定を解釈する
+// 例: ":jpeg:0:75,thumb:jpeg:320:80,webp:webp:0:0"
+func ParseRenditions(spec string) ([]*Rendition, error) {
+	var renditions []*Rendition
+	keys := map[string]struct{}{}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		fields := strings.Split(entry, ":")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("rendition %q must be {name}:{format}:{width}:{quality}", entry)
+		}
+
+		r := &Rendition{
+			Name:   fields[0],
+			Format: fields[1],
+		}
+
+		if strings.ContainsAny(r.Name, "/.") {
+			return nil, fmt.Errorf("rendition %q: name must not contain '/' or '.'", entry)
+		}
+
+		switch r.Format {
+		case FormatJPEG, FormatPNG, FormatWebP:
+		default:
+			return nil, fmt.Errorf("rendition %q: unknown format %q", entry, r.Format)
+		}
+
+		width, err := strconv.Atoi(fields[2])
+		if err != nil || width < 0 {
+			return nil, fmt.Errorf("rendition %q: invalid width %q", entry, fields[2])
+		}
+		r.Width = width
+
+		quality, err := strconv.Atoi(fields[3])
+		if err != nil || quality < 0 || quality > 100 {
+			return nil, fmt.Errorf("rendition %q: invalid quality %q", entry, fields[3])
+		}
+		r.Quality = quality
+
+		// PNG と WebP はロスレスでしか書き出さないので、品質を指定しても効かない
+		if r.Quality != 0 && r.Format != FormatJPEG {
+			return nil, fmt.Errorf("rendition %q: quality is only supported for %s, use 0 for %s", entry, FormatJPEG, r.Format)
+		}
+
+		key := r.Key("")
+		if _, ok := keys[key]; ok {
+			return nil, fmt.Errorf("rendition %q: duplicate key %s", entry, key)
+		}
+		keys[key] = struct{}{}
+
+		renditions = append(renditions, r)
+	}
+
+	if len(renditions) == 0 {
+		return nil, fmt.Errorf("at least one rendition is required")
+	}
+
+	return renditions, nil
+}
+
+// 縦横比を保って幅 width に縮小する
+func resize(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if width <= 0 || width >= b.Dx() {
+		return img
+	}
+
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+
+	return dst
+}
+
+func (r *Rendition) Render(img image.Image) ([]byte, error) {
+	img = resize(img, r.Width)
+
+	buf := new(bytes.Buffer)
+	switch r.Format {
+	case FormatJPEG:
+		var o *jpeg.Options
+		if r.Quality > 0 {
+			o = &jpeg.Options{Quality: r.Quality}
+		}
+		if err := jpeg.Encode(buf, img, o); err != nil {
+			return nil, err
+		}
+	case FormatPNG:
+		if err := png.Encode(buf, img); err != nil {
+			return nil, err
+		}
+	case FormatWebP:
+		if err := nativewebp.Encode(buf, img, nil); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q", r.Format)
+	}
+
+	return buf.Bytes(), nil
+}
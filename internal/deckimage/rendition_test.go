@@ -0,0 +1,126 @@
+package deckimage
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	_ "golang.org/x/image/webp"
+)
+
+func TestParseRenditions(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []Rendition
+		wantErr bool
+	}{
+		{
+			name: "default",
+			spec: ":jpeg:0:75,thumb:jpeg:320:80,webp:webp:0:0",
+			want: []Rendition{
+				{Name: "", Format: FormatJPEG, Width: 0, Quality: 75},
+				{Name: "thumb", Format: FormatJPEG, Width: 320, Quality: 80},
+				{Name: "webp", Format: FormatWebP, Width: 0, Quality: 0},
+			},
+		},
+		{
+			name: "spaces and empty entries",
+			spec: " png:png:640:0 ,, ",
+			want: []Rendition{
+				{Name: "png", Format: FormatPNG, Width: 640, Quality: 0},
+			},
+		},
+		{name: "empty", spec: "", wantErr: true},
+		{name: "missing field", spec: "thumb:jpeg:320", wantErr: true},
+		{name: "unknown format", spec: "thumb:gif:320:0", wantErr: true},
+		{name: "name with slash", spec: "a/b:jpeg:0:0", wantErr: true},
+		{name: "name with dot", spec: "a.b:jpeg:0:0", wantErr: true},
+		{name: "negative width", spec: "thumb:jpeg:-1:0", wantErr: true},
+		{name: "quality out of range", spec: "thumb:jpeg:0:101", wantErr: true},
+		{name: "quality for png", spec: "png:png:0:80", wantErr: true},
+		{name: "quality for webp", spec: "webp:webp:0:70", wantErr: true},
+		{name: "duplicate key", spec: "thumb:jpeg:320:80,thumb:jpeg:160:80", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRenditions(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRenditions(%q) = %v, want error", tt.spec, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRenditions(%q) error = %v", tt.spec, err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseRenditions(%q) = %d renditions, want %d", tt.spec, len(got), len(tt.want))
+			}
+			for i := range tt.want {
+				if *got[i] != tt.want[i] {
+					t.Errorf("ParseRenditions(%q)[%d] = %+v, want %+v", tt.spec, i, *got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRenditionKey(t *testing.T) {
+	tests := []struct {
+		rendition Rendition
+		want      string
+	}{
+		{Rendition{Name: "", Format: FormatJPEG}, "images/decks/abc.jpg"},
+		{Rendition{Name: "thumb", Format: FormatJPEG}, "images/decks/thumb/abc.jpg"},
+		{Rendition{Name: "webp", Format: FormatWebP}, "images/decks/webp/abc.webp"},
+		{Rendition{Name: "png", Format: FormatPNG}, "images/decks/png/abc.png"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.rendition.Key("abc"); got != tt.want {
+			t.Errorf("%+v.Key(abc) = %s, want %s", tt.rendition, got, tt.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			src.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	tests := []struct {
+		rendition  Rendition
+		wantWidth  int
+		wantHeight int
+	}{
+		{Rendition{Format: FormatJPEG, Quality: 75}, 400, 200},
+		{Rendition{Format: FormatJPEG, Width: 100}, 100, 50},
+		{Rendition{Format: FormatPNG, Width: 800}, 400, 200},
+		{Rendition{Format: FormatWebP, Width: 200}, 200, 100},
+	}
+
+	for _, tt := range tests {
+		b, err := tt.rendition.Render(src)
+		if err != nil {
+			t.Fatalf("%+v.Render() error = %v", tt.rendition, err)
+		}
+
+		img, format, err := image.Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%+v.Render() produced an undecodable image: %v", tt.rendition, err)
+		}
+		if format != tt.rendition.Format {
+			t.Errorf("%+v.Render() format = %s, want %s", tt.rendition, format, tt.rendition.Format)
+		}
+		if got := img.Bounds(); got.Dx() != tt.wantWidth || got.Dy() != tt.wantHeight {
+			t.Errorf("%+v.Render() size = %dx%d, want %dx%d", tt.rendition, got.Dx(), got.Dy(), tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
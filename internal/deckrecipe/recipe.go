@@ -0,0 +1,80 @@
+package deckrecipe
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/archetype"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/deck"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/metrics"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+// デッキのカード構成を取得して保存する
+// 取得済みのデッキはスキップする
+func Import(ctx context.Context, ds deck.DeckSource, deckRepo repository.DeckRepository, deckCode string) error {
+	exists, err := deckRepo.Exists(ctx, deckCode)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	cards, err := ds.GetDeckCards(ctx, deckCode)
+	if err != nil {
+		// 非公開や削除済みのデッキは何度取得しても見つからないのでスキップする
+		if errors.Is(err, deck.ErrDeckNotFound) {
+			slog.Warn("Deck not found on the official site, skipping its recipe", logging.KeyDeckCode, deckCode, logging.KeyStage, metrics.StageDeckRecipe)
+			return nil
+		}
+		return err
+	}
+
+	// 同じカードが重複して記載されている場合は枚数を合算する
+	type cardKey struct {
+		category string
+		cardId   string
+	}
+	merged := map[cardKey]*model.DeckCard{}
+	dcs := make([]*model.DeckCard, 0, len(cards))
+	for _, c := range cards {
+		k := cardKey{c.Category, c.CardId}
+		if dc, ok := merged[k]; ok {
+			dc.Count += c.Count
+			continue
+		}
+
+		dc := model.NewDeckCard(deckCode, c.Category, c.CardId, c.Name, c.Count)
+		merged[k] = dc
+		dcs = append(dcs, dc)
+	}
+
+	return deckRepo.Save(ctx, model.NewDeck(deckCode, time.Now()), dcs)
+}
+
+// 保存済みのカード構成からデッキのアーキタイプを判定し、デッキコードが一致する成績を更新する
+// 判定ルールが指定されていない場合やカード構成を取得できていないデッキは判定しない
+func Classify(ctx context.Context, classifier *archetype.Classifier, deckRepo repository.DeckRepository, resultRepo repository.ResultRepository, deckCode string) error {
+	if classifier == nil {
+		return nil
+	}
+
+	cards, err := deckRepo.FindCards(ctx, deckCode)
+	if err != nil {
+		return err
+	}
+
+	if len(cards) == 0 {
+		return nil
+	}
+
+	_, err = resultRepo.UpdateArchetype(ctx, deckCode, classifier.Classify(cards))
+
+	return err
+}
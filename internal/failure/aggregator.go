@@ -0,0 +1,104 @@
+package failure
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// 実行中に発生したエラーを分類ごとに数え、終了コードを決める
+// ゴルーチンから並行して呼び出せる
+type Aggregator struct {
+	// この件数を超えるエラーが発生したら異常終了する
+	threshold int
+
+	mu       sync.Mutex
+	counts   map[string]int
+	total    int
+	dropped  int
+	exitCode int
+}
+
+func NewAggregator(threshold int) *Aggregator {
+	return &Aggregator{
+		threshold: threshold,
+		counts:    map[string]int{},
+	}
+}
+
+// category は metrics.Category* のいずれか
+// 異常終了するときは、記録したエラーのうち最も大きい exitCode を使う
+func (a *Aggregator) Add(category string, exitCode int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.counts[category]++
+	a.total++
+	if exitCode > a.exitCode {
+		a.exitCode = exitCode
+	}
+}
+
+// 個別のログを出さずに件数だけ数えたエラー
+// Add で数えたうえで呼び出す
+func (a *Aggregator) Drop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.dropped++
+}
+
+func (a *Aggregator) Total() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.total
+}
+
+func (a *Aggregator) Dropped() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.dropped
+}
+
+// エラーの件数が閾値以下なら 0 を返す
+func (a *Aggregator) ExitCode() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.total <= a.threshold {
+		return 0
+	}
+
+	// exitCode を指定せずに記録されたエラーでも異常終了させる
+	if a.exitCode == 0 {
+		return 1
+	}
+
+	return a.exitCode
+}
+
+// 分類ごとの件数をログの属性にする
+func (a *Aggregator) Attrs() []any {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	categories := make([]string, 0, len(a.counts))
+	for category := range a.counts {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	byCategory := make([]any, 0, len(categories))
+	for _, category := range categories {
+		byCategory = append(byCategory, slog.Int(category, a.counts[category]))
+	}
+
+	return []any{
+		"errors", a.total,
+		"dropped", a.dropped,
+		"threshold", a.threshold,
+		slog.Group("errors_by_category", byCategory...),
+	}
+}
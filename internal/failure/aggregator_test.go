@@ -0,0 +1,122 @@
+package failure
+
+import (
+	"bytes"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+type added struct {
+	category string
+	exitCode int
+}
+
+func TestAggregatorExitCode(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		added     []added
+		want      int
+	}{
+		{
+			name:      "no errors",
+			threshold: 0,
+			want:      0,
+		},
+		{
+			name:      "one error over zero threshold",
+			threshold: 0,
+			added:     []added{{"fetch", 1}},
+			want:      1,
+		},
+		{
+			name:      "errors within threshold",
+			threshold: 2,
+			added:     []added{{"fetch", 1}, {"save", 1}},
+			want:      0,
+		},
+		{
+			name:      "errors over threshold",
+			threshold: 2,
+			added:     []added{{"fetch", 1}, {"save", 1}, {"save", 1}},
+			want:      1,
+		},
+		{
+			name:      "largest exit code wins",
+			threshold: 0,
+			added:     []added{{"fetch", 1}, {"dead_letter", 3}, {"save", 2}},
+			want:      3,
+		},
+		{
+			name:      "exit code 0 still fails",
+			threshold: 0,
+			added:     []added{{"fetch", 0}},
+			want:      1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAggregator(tt.threshold)
+			for _, e := range tt.added {
+				a.Add(e.category, e.exitCode)
+			}
+
+			if got := a.ExitCode(); got != tt.want {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.want)
+			}
+			if got := a.Total(); got != len(tt.added) {
+				t.Errorf("Total() = %d, want %d", got, len(tt.added))
+			}
+		})
+	}
+}
+
+func TestAggregatorConcurrent(t *testing.T) {
+	a := NewAggregator(0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			a.Add("fetch", 1)
+			if i%2 == 0 {
+				a.Drop()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := a.Total(); got != 100 {
+		t.Errorf("Total() = %d, want 100", got)
+	}
+	if got := a.Dropped(); got != 50 {
+		t.Errorf("Dropped() = %d, want 50", got)
+	}
+}
+
+func TestAggregatorAttrs(t *testing.T) {
+	a := NewAggregator(5)
+	a.Add("save", 1)
+	a.Add("fetch", 1)
+	a.Add("save", 1)
+	a.Drop()
+
+	buf := new(bytes.Buffer)
+	logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+	logger.Info("summary", a.Attrs()...)
+
+	want := "level=INFO msg=summary errors=3 dropped=1 threshold=5 errors_by_category.fetch=1 errors_by_category.save=2\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Attrs() logged %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,320 @@
+package importer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/archetype"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/deckimage"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/eventresult"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/metrics"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+// enqueue がキューに送る公式イベント
+type OfficialEvent struct {
+	ID              uint      `json:"id"`
+	Title           string    `json:"title"`
+	Address         string    `json:"address"`
+	Venue           string    `json:"venue"`
+	Date            time.Time `json:"date"`
+	StartedAt       time.Time `json:"started_at"`
+	EndedAt         time.Time `json:"ended_at"`
+	TypeName        string    `json:"type_name"`
+	LeagueTitle     string    `json:"league_title"`
+	RegulationTitle string    `json:"regulation_title"`
+	CSPFlg          bool      `json:"csp_flg"`
+	Capacity        uint      `json:"capacity"`
+	ShopId          uint      `json:"shop_id"`
+	ShopName        string    `json:"shop_name"`
+}
+
+func DecodeEvent(content string) (*OfficialEvent, error) {
+	v, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+
+	var event OfficialEvent
+	if err := json.Unmarshal(v, &event); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	return &event, nil
+}
+
+// 取り込みの失敗
+type Error struct {
+	// metrics.Category* のいずれか
+	Category string
+	Message  string
+	Err      error
+	// ログに付ける属性 (slog のキーと値の組)
+	Attrs []any
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// 1件のイベントを取り込んだ結果
+type Status int
+
+const (
+	// 成績を取り込んだ
+	StatusImported Status = iota
+	// 成績がまだ公開されていない
+	// メッセージは削除せずに再配信に任せる
+	StatusNoResults
+	// 開催期間が未登録なので保留した
+	StatusParked
+)
+
+type Result struct {
+	Status Status
+	// StatusImported のときだけ設定する
+	Stats          *repository.ReplaceStats
+	ImagesEnqueued int
+}
+
+// キューから受け取ったイベントの成績を取り込む
+type Importer struct {
+	ers          eventresult.EventResultSource
+	scheduleRepo repository.ScheduleRepository
+	resultRepo   repository.ResultRepository
+	pendingRepo  repository.PendingEventRepository
+	deckRepo     repository.DeckRepository
+	// nil の場合はアーキタイプを判定しない
+	classifier *archetype.Classifier
+	// デッキ画像のアップロード依頼を送るキュー
+	imageMQ simplemq.SimpleMQ
+	m       *metrics.Metrics
+}
+
+func NewImporter(
+	ers eventresult.EventResultSource,
+	scheduleRepo repository.ScheduleRepository,
+	resultRepo repository.ResultRepository,
+	pendingRepo repository.PendingEventRepository,
+	deckRepo repository.DeckRepository,
+	classifier *archetype.Classifier,
+	imageMQ simplemq.SimpleMQ,
+	m *metrics.Metrics,
+) *Importer {
+	return &Importer{
+		ers:          ers,
+		scheduleRepo: scheduleRepo,
+		resultRepo:   resultRepo,
+		pendingRepo:  pendingRepo,
+		deckRepo:     deckRepo,
+		classifier:   classifier,
+		imageMQ:      imageMQ,
+		m:            m,
+	}
+}
+
+func leagueType(leagueTitle string) uint {
+	switch leagueTitle {
+	case "オープン":
+		return 1
+	case "ジュニア":
+		return 2
+	case "シニア":
+		return 3
+	case "マスター":
+		return 4
+	default:
+		return 0
+	}
+}
+
+// デッキのアーキタイプを判定する
+// 判定ルールが指定されていない場合は判定しない
+// カード構成を取得していないデッキは、deckimages がカード構成を取得したときに判定する
+func (i *Importer) classifyDeck(ctx context.Context, deckCode string) (string, error) {
+	if i.classifier == nil || deckCode == "" {
+		return archetype.Unclassified, nil
+	}
+
+	cards, err := i.deckRepo.FindCards(ctx, deckCode)
+	if err != nil {
+		return "", err
+	}
+
+	return i.classifier.Classify(cards), nil
+}
+
+// イベントの成績を取得して書き込み、デッキ画像のアップロードを依頼する
+// content は保留するときにそのまま保存し、開催期間が登録されたらキューに戻す
+// 失敗した場合は *Error を返す
+func (i *Importer) Import(ctx context.Context, event *OfficialEvent, content string) (*Result, error) {
+	defer i.m.Time(metrics.StageEvent)()
+
+	// イベントの結果を取得
+	done := i.m.Time(metrics.StageEventResults)
+	results, err := i.ers.GetEventResults(ctx, event.ID)
+	done()
+	if err != nil {
+		return nil, &Error{
+			Category: metrics.CategoryEventResults,
+			Message:  "Failed to get event results",
+			Err:      err,
+		}
+	}
+
+	if len(results) == 0 {
+		return &Result{Status: StatusNoResults}, nil
+	}
+
+	// 対象期間中のシティーリーグのIDを取得する
+	cs, err := i.scheduleRepo.FindByDate(ctx, event.Date)
+	if err != nil {
+		// 開催期間が未登録のイベントは失敗扱いにせず、登録されるまで保留する
+		var notFound *repository.ScheduleNotFoundError
+		if errors.As(err, &notFound) {
+			if err := i.pendingRepo.Save(ctx, model.NewPendingEvent(event.ID, event.Date, content, err.Error())); err != nil {
+				return nil, &Error{
+					Category: metrics.CategorySchedule,
+					Message:  "Failed to park unscheduled event",
+					Err:      err,
+				}
+			}
+
+			return &Result{Status: StatusParked}, nil
+		}
+
+		return nil, &Error{
+			Category: metrics.CategorySchedule,
+			Message:  "Failed to find cityleague schedule",
+			Err:      err,
+			Attrs:    []any{"date", event.Date.Format(time.DateOnly)},
+		}
+	}
+
+	// デッキのカード構成と画像は公式サイトの障害で成績の取り込みが止まらないよう、deckimages が取得する
+	deckCodes := make([]string, 0, len(results))
+	for _, result := range results {
+		if result.DeckId != "" {
+			deckCodes = append(deckCodes, result.DeckId)
+		}
+	}
+
+	lt := leagueType(event.LeagueTitle)
+	rows := make([]*model.CityleagueResult, 0, len(results))
+	for _, result := range results {
+		archetypeId, err := i.classifyDeck(ctx, result.DeckId)
+		if err != nil {
+			return nil, &Error{
+				Category: metrics.CategoryClassify,
+				Message:  "Failed to classify deck",
+				Err:      err,
+				Attrs:    []any{logging.KeyDeckCode, result.DeckId, logging.KeyPlayerID, result.PlayerId},
+			}
+		}
+
+		r := model.NewCityleagueResult(
+			cs.ID,
+			event.ID,
+			lt,
+			event.Date,
+			result.PlayerId,
+			result.Name,
+			result.Rank,
+			result.Point,
+			result.DeckId,
+			archetypeId,
+		)
+
+		slog.Debug("Cityleague result",
+			logging.KeyEventID, event.ID,
+			logging.KeyPlayerID, result.PlayerId,
+			logging.KeyDeckCode, result.DeckId,
+			"cityleague_schedule_id", cs.ID,
+			"rank", result.Rank,
+			"point", result.Point,
+			"archetype_id", archetypeId,
+		)
+
+		rows = append(rows, r)
+	}
+
+	done = i.m.Time(metrics.StageImport)
+	stats, err := i.resultRepo.ReplaceEvent(ctx, event.ID, rows)
+	done()
+	if err != nil {
+		return nil, &Error{
+			Category: metrics.CategoryImport,
+			Message:  "Failed to import cityleague results",
+			Err:      err,
+		}
+	}
+
+	i.m.Results.WithLabelValues(metrics.OutcomeInserted).Add(float64(stats.Inserted))
+	i.m.Results.WithLabelValues(metrics.OutcomeUpdated).Add(float64(stats.Updated))
+	i.m.Results.WithLabelValues(metrics.OutcomeUnchanged).Add(float64(stats.Unchanged))
+	i.m.Results.WithLabelValues(metrics.OutcomeDeleted).Add(float64(stats.Deleted))
+
+	// カード構成や画像の取得に失敗しても成績の取り込みは止めない
+	// 依頼を送れなかった場合は再配信で成績ごと取り込み直す
+	done = i.m.Time(metrics.StageEnqueueImages)
+	n, err := deckimage.Enqueue(ctx, i.imageMQ, deckCodes)
+	done()
+	if err != nil {
+		return nil, &Error{
+			Category: metrics.CategoryEnqueueImages,
+			Message:  "Failed to enqueue deck images",
+			Err:      err,
+		}
+	}
+
+	return &Result{
+		Status:         StatusImported,
+		Stats:          stats,
+		ImagesEnqueued: n,
+	}, nil
+}
+
+// 保留中のイベントのうち、開催期間が登録されたものを mqc に戻す
+// 個別のイベントの失敗は onError に渡して残りのイベントを続ける
+func (i *Importer) RequeuePendingEvents(ctx context.Context, mqc simplemq.SimpleMQ, onError func(eventId uint, message string, err error)) error {
+	pes, err := i.pendingRepo.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, pe := range pes {
+		if _, err := i.scheduleRepo.FindByDate(ctx, pe.EventDate); err != nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				onError(pe.OfficialEventId, "Failed to find cityleague schedule of pending event", err)
+			}
+			continue
+		}
+
+		if _, err := mqc.SendMessage(ctx, &simplemq.SendMessageRequest{Content: pe.Content}); err != nil {
+			onError(pe.OfficialEventId, "Failed to requeue pending event", err)
+			continue
+		}
+
+		// 削除できなかった場合は次回も送り直すが、取り込みは冪等なので問題ない
+		if err := i.pendingRepo.Delete(ctx, pe.OfficialEventId); err != nil {
+			onError(pe.OfficialEventId, "Failed to delete requeued pending event", err)
+			continue
+		}
+
+		slog.Info("Requeued pending event now that a cityleague schedule covers it", logging.KeyEventID, pe.OfficialEventId, "date", pe.EventDate.Format(time.DateOnly))
+	}
+
+	return nil
+}
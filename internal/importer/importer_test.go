@@ -0,0 +1,347 @@
+package importer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/archetype"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/deckimage"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/eventresult"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/memory"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/metrics"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+type stubSource struct {
+	results map[uint][]*eventresult.EventResult
+	err     error
+}
+
+func (s *stubSource) GetEventResults(ctx context.Context, eventId uint) ([]*eventresult.EventResult, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return s.results[eventId], nil
+}
+
+// 指定した内容のメッセージだけ送信に失敗する
+type failingMQ struct {
+	simplemq.SimpleMQ
+	content string
+}
+
+func (q *failingMQ) SendMessage(ctx context.Context, msgReq *simplemq.SendMessageRequest) (*simplemq.SendMessageResponse, error) {
+	if msgReq.Content == q.content {
+		return nil, errors.New("send failed")
+	}
+
+	return q.SimpleMQ.SendMessage(ctx, msgReq)
+}
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func encodeEvent(t *testing.T, event *OfficialEvent) string {
+	t.Helper()
+
+	v, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(v)
+}
+
+func receiveAll(t *testing.T, mqc simplemq.SimpleMQ) []string {
+	t.Helper()
+
+	contents := []string{}
+	for {
+		res, err := mqc.ReceiveMessage(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Messages) == 0 {
+			return contents
+		}
+		contents = append(contents, res.Messages[0].Content)
+	}
+}
+
+type fixture struct {
+	source       *stubSource
+	scheduleRepo repository.ScheduleRepository
+	resultRepo   repository.ResultRepository
+	pendingRepo  repository.PendingEventRepository
+	deckRepo     repository.DeckRepository
+	imageMQ      simplemq.SimpleMQ
+	importer     *Importer
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	classifier, err := archetype.NewClassifier(&archetype.Rules{
+		Archetypes: []*archetype.Archetype{
+			{Id: "charizard", Name: "リザードンex", Conditions: []*archetype.Condition{{Name: "リザードンex"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fixture{
+		source: &stubSource{
+			results: map[uint][]*eventresult.EventResult{
+				512345: {
+					{PlayerId: "3120000001", Name: "山田 太郎", Rank: 1, Point: 200, DeckId: "deck-a"},
+					{PlayerId: "3120000002", Name: "佐藤 花子", Rank: 2, Point: 160},
+					{PlayerId: "3120000003", Name: "鈴木 一郎", Rank: 3, Point: 120, DeckId: "deck-b"},
+					{PlayerId: "3120000004", Name: "高橋 次郎", Rank: 4, Point: 100, DeckId: "deck-a"},
+				},
+			},
+		},
+		scheduleRepo: memory.NewScheduleRepository(&model.CityleagueSchedule{
+			ID:       "CL2026S1",
+			Title:    "シティリーグ2026 シーズン1",
+			FromDate: date("2026-04-01"),
+			ToDate:   date("2026-06-30"),
+		}),
+		resultRepo:  memory.NewResultRepository(),
+		pendingRepo: memory.NewPendingEventRepository(),
+		deckRepo:    memory.NewDeckRepository(),
+		imageMQ:     simplemq.NewMemoryMQ(simplemq.DefaultVisibilityTimeout, simplemq.DefaultRetentionPeriod),
+	}
+
+	if err := f.deckRepo.Save(context.Background(), model.NewDeck("deck-a", time.Now()), []*model.DeckCard{
+		model.NewDeckCard("deck-a", "pokemon", "47013", "リザードンex", 2),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	f.importer = NewImporter(f.source, f.scheduleRepo, f.resultRepo, f.pendingRepo, f.deckRepo, classifier, f.imageMQ, metrics.New("dequeue"))
+
+	return f
+}
+
+func TestDecodeEvent(t *testing.T) {
+	event := &OfficialEvent{ID: 512345, Date: date("2026-05-10"), LeagueTitle: "マスター"}
+
+	got, err := DecodeEvent(encodeEvent(t, event))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != event.ID || !got.Date.Equal(event.Date) || got.LeagueTitle != event.LeagueTitle {
+		t.Errorf("DecodeEvent = %+v, want %+v", got, event)
+	}
+
+	for _, content := range []string{"%%%", base64.StdEncoding.EncodeToString([]byte("{"))} {
+		if _, err := DecodeEvent(content); err == nil {
+			t.Errorf("DecodeEvent(%q) succeeded, want error", content)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	event := &OfficialEvent{ID: 512345, Date: date("2026-05-10"), LeagueTitle: "マスター"}
+
+	res, err := f.importer.Import(ctx, event, encodeEvent(t, event))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusImported {
+		t.Fatalf("Status = %v, want StatusImported", res.Status)
+	}
+	if res.Stats.Inserted != 4 {
+		t.Errorf("Inserted = %d, want 4", res.Stats.Inserted)
+	}
+	// 重複したデッキコードと空のデッキコードは送らない
+	if res.ImagesEnqueued != 2 {
+		t.Errorf("ImagesEnqueued = %d, want 2", res.ImagesEnqueued)
+	}
+
+	rows, err := f.resultRepo.FindByOfficialEventId(ctx, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archetypes := map[string]string{}
+	for _, r := range rows {
+		if r.CityleagueScheduleId != "CL2026S1" || r.LeagueType != 4 || !r.EventDate.Equal(event.Date) {
+			t.Errorf("row = %+v, want schedule CL2026S1, league type 4 and date %v", r, event.Date)
+		}
+		archetypes[r.PlayerId] = r.ArchetypeId
+	}
+	want := map[string]string{
+		"3120000001": "charizard",
+		"3120000002": archetype.Unclassified,
+		// カード構成を取得していないデッキは判定しない
+		"3120000003": archetype.Unclassified,
+		"3120000004": "charizard",
+	}
+	for playerId, archetypeId := range want {
+		if got, ok := archetypes[playerId]; !ok || got != archetypeId {
+			t.Errorf("archetype of %s = %q, want %q", playerId, got, archetypeId)
+		}
+	}
+
+	jobs := map[string]struct{}{}
+	for _, content := range receiveAll(t, f.imageMQ) {
+		job, err := deckimage.DecodeJob(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs[job.DeckCode] = struct{}{}
+	}
+	if _, ok := jobs["deck-a"]; !ok || len(jobs) != 2 {
+		t.Errorf("enqueued jobs = %v, want deck-a and deck-b", jobs)
+	}
+
+	// 再配信で取り込み直しても行は変わらない
+	res, err = f.importer.Import(ctx, event, encodeEvent(t, event))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stats.Unchanged != 4 || res.Stats.Inserted != 0 || res.Stats.Updated != 0 || res.Stats.Deleted != 0 {
+		t.Errorf("Stats of reimport = %+v, want 4 unchanged", res.Stats)
+	}
+}
+
+func TestImportNoResults(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	event := &OfficialEvent{ID: 599999, Date: date("2026-05-10")}
+
+	res, err := f.importer.Import(ctx, event, encodeEvent(t, event))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNoResults {
+		t.Errorf("Status = %v, want StatusNoResults", res.Status)
+	}
+
+	pes, err := f.pendingRepo.FindAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pes) != 0 {
+		t.Errorf("pending events = %d, want 0", len(pes))
+	}
+}
+
+func TestImportParked(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	// 開催期間が登録されていない日付
+	event := &OfficialEvent{ID: 512345, Date: date("2026-08-01")}
+	content := encodeEvent(t, event)
+
+	res, err := f.importer.Import(ctx, event, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusParked {
+		t.Fatalf("Status = %v, want StatusParked", res.Status)
+	}
+
+	pes, err := f.pendingRepo.FindAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pes) != 1 || pes[0].OfficialEventId != event.ID || pes[0].Content != content {
+		t.Errorf("pending events = %+v, want event %d with the message content", pes, event.ID)
+	}
+
+	rows, err := f.resultRepo.FindByOfficialEventId(ctx, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("rows = %d, want 0", len(rows))
+	}
+}
+
+func TestImportError(t *testing.T) {
+	f := newFixture(t)
+	f.source.err = errors.New("503 Service Unavailable")
+
+	event := &OfficialEvent{ID: 512345, Date: date("2026-05-10")}
+
+	_, err := f.importer.Import(context.Background(), event, encodeEvent(t, event))
+
+	var ierr *Error
+	if !errors.As(err, &ierr) {
+		t.Fatalf("Import error = %v, want *Error", err)
+	}
+	if ierr.Category != metrics.CategoryEventResults {
+		t.Errorf("Category = %q, want %q", ierr.Category, metrics.CategoryEventResults)
+	}
+	if !errors.Is(err, f.source.err) {
+		t.Errorf("Import error = %v, want it to wrap %v", err, f.source.err)
+	}
+}
+
+func TestRequeuePendingEvents(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	scheduled := &OfficialEvent{ID: 1, Date: date("2026-05-10")}
+	failing := &OfficialEvent{ID: 2, Date: date("2026-05-11")}
+	unscheduled := &OfficialEvent{ID: 3, Date: date("2026-08-01")}
+	for _, event := range []*OfficialEvent{scheduled, failing, unscheduled} {
+		if err := f.pendingRepo.Save(ctx, model.NewPendingEvent(event.ID, event.Date, encodeEvent(t, event), "not found")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mqc := simplemq.NewMemoryMQ(simplemq.DefaultVisibilityTimeout, simplemq.DefaultRetentionPeriod)
+	failed := []uint{}
+	onError := func(eventId uint, message string, err error) {
+		failed = append(failed, eventId)
+	}
+
+	// 送信に失敗したイベントがあっても残りのイベントを戻す
+	if err := f.importer.RequeuePendingEvents(ctx, &failingMQ{SimpleMQ: mqc, content: encodeEvent(t, failing)}, onError); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) != 1 || failed[0] != failing.ID {
+		t.Errorf("failed events = %v, want [%d]", failed, failing.ID)
+	}
+
+	contents := receiveAll(t, mqc)
+	if len(contents) != 1 || contents[0] != encodeEvent(t, scheduled) {
+		t.Errorf("requeued = %v, want event %d", contents, scheduled.ID)
+	}
+
+	pes, err := f.pendingRepo.FindAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining := map[uint]struct{}{}
+	for _, pe := range pes {
+		remaining[pe.OfficialEventId] = struct{}{}
+	}
+	_, hasFailing := remaining[failing.ID]
+	_, hasUnscheduled := remaining[unscheduled.ID]
+	if len(remaining) != 2 || !hasFailing || !hasUnscheduled {
+		t.Errorf("remaining pending events = %v, want %d and %d", remaining, failing.ID, unscheduled.ID)
+	}
+}
@@ -0,0 +1,142 @@
+package importrun
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+// 1回の実行に記録するエラーの上限
+// 件数は ErrorCount に上限を超えても数える
+const maxErrorRecords = 1000
+
+type ErrorRecord struct {
+	At       time.Time `json:"at"`
+	Category string    `json:"category"`
+	Message  string    `json:"message"`
+	Error    string    `json:"error"`
+	EventId  uint      `json:"event_id,omitempty"`
+	MsgId    string    `json:"msg_id,omitempty"`
+}
+
+// 実行中の件数とエラーを集計し、import_runs に記録する
+// ゴルーチンから並行して呼び出せる
+type Ledger struct {
+	repo repository.ImportRunRepository
+
+	mu     sync.Mutex
+	run    *model.ImportRun
+	errors []ErrorRecord
+}
+
+// 実行の開始を記録する
+// 途中で異常終了しても開始したことが残るように、最初に行を作っておく
+func Start(ctx context.Context, repo repository.ImportRunRepository, command string) (*Ledger, error) {
+	run := model.NewImportRun(command, time.Now())
+	if err := repo.Create(ctx, run); err != nil {
+		return nil, err
+	}
+
+	return &Ledger{
+		repo:   repo,
+		run:    run,
+		errors: []ErrorRecord{},
+	}, nil
+}
+
+func (l *Ledger) ID() uint {
+	return l.run.ID
+}
+
+func (l *Ledger) MessageProcessed() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.run.MessagesProcessed++
+}
+
+// イベントの成績を取り込んだときに書き込んだ行数を加算する
+func (l *Ledger) EventImported(stats *repository.ReplaceStats) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.run.EventsImported++
+	l.run.RowsInserted += stats.Inserted
+	l.run.RowsUpdated += stats.Updated
+	l.run.RowsUnchanged += stats.Unchanged
+	l.run.RowsDeleted += stats.Deleted
+}
+
+func (l *Ledger) ImagesEnqueued(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.run.ImagesEnqueued += n
+}
+
+func (l *Ledger) ImagesUploaded(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.run.ImagesUploaded += n
+}
+
+// category は metrics.Category* のいずれか
+// イベントやメッセージに関係しないエラーは eventId を 0、msgId を空にする
+func (l *Ledger) Error(category string, message string, err error, eventId uint, msgId string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.run.ErrorCount++
+	if len(l.errors) >= maxErrorRecords {
+		return
+	}
+
+	r := ErrorRecord{
+		At:       time.Now(),
+		Category: category,
+		Message:  message,
+		EventId:  eventId,
+		MsgId:    msgId,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	l.errors = append(l.errors, r)
+}
+
+// 実行の終了を記録する
+func (l *Ledger) Finish(ctx context.Context, interrupted bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, err := json.Marshal(l.errors)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	l.run.EndedAt = &now
+	l.run.Interrupted = interrupted
+	l.run.Errors = string(b)
+
+	return l.repo.Save(ctx, l.run)
+}
+
+// 記録済みの実行のエラーを読み出す
+func Errors(run *model.ImportRun) ([]ErrorRecord, error) {
+	var records []ErrorRecord
+	if run.Errors == "" {
+		return records, nil
+	}
+
+	if err := json.Unmarshal([]byte(run.Errors), &records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
@@ -0,0 +1,165 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 試行記録と dead letter を区別するキューの名前
+// キューの接続先を変えても記録が引き継がれるよう、接続先ではなく用途で区別する
+const (
+	QueueImport     = "import"
+	QueueDeckImages = "deck_images"
+)
+
+type ErrorRecord struct {
+	At    time.Time `json:"at"`
+	Error string    `json:"error"`
+}
+
+// メッセージごとの配信試行回数を記録し、上限を超えたものを dead_letters に移す
+// 記録はキューごとに分ける
+type Tracker struct {
+	db          *gorm.DB
+	queue       string
+	maxAttempts uint
+}
+
+func NewTracker(db *gorm.DB, queue string, maxAttempts uint) *Tracker {
+	return &Tracker{
+		db:          db,
+		queue:       queue,
+		maxAttempts: maxAttempts,
+	}
+}
+
+func appendError(history string, cause error) (string, error) {
+	var records []ErrorRecord
+	if history != "" {
+		if err := json.Unmarshal([]byte(history), &records); err != nil {
+			return "", err
+		}
+	}
+
+	records = append(records, ErrorRecord{
+		At:    time.Now(),
+		Error: cause.Error(),
+	})
+
+	b, err := json.Marshal(records)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (t *Tracker) moveToDeadLetter(tx *gorm.DB, msg *simplemq.Message, attempts uint, history string) error {
+	dl := model.NewDeadLetter(t.queue, msg.ID, msg.Content, attempts, history)
+
+	// キューからの削除に失敗して再配信された場合は上書きする
+	if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(dl).Error; err != nil {
+		return err
+	}
+
+	return tx.Delete(&model.MessageDelivery{}, "queue = ? AND message_id = ?", t.queue, msg.ID).Error
+}
+
+// 処理の失敗を記録する
+// 試行回数が上限に達した場合は dead_letters に移して true を返すので、呼び出し側でキューから削除すること
+func (t *Tracker) RecordFailure(ctx context.Context, msg *simplemq.Message, cause error) (bool, error) {
+	deadLettered := false
+
+	err := t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var md model.MessageDelivery
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("queue = ? AND message_id = ?", t.queue, msg.ID).
+			First(&md).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			md = model.MessageDelivery{Queue: t.queue, MessageId: msg.ID}
+		}
+
+		history, err := appendError(md.Errors, cause)
+		if err != nil {
+			return err
+		}
+
+		md.Attempts++
+		md.Errors = history
+
+		if md.Attempts >= t.maxAttempts {
+			deadLettered = true
+			return t.moveToDeadLetter(tx, msg, md.Attempts, md.Errors)
+		}
+
+		return tx.Save(&md).Error
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deadLettered, nil
+}
+
+// 再試行しても成功しないメッセージを試行回数に関係なく dead_letters に移す
+// 呼び出し側でキューから削除すること
+func (t *Tracker) DeadLetter(ctx context.Context, msg *simplemq.Message, cause error) error {
+	return t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var md model.MessageDelivery
+		if err := tx.Where("queue = ? AND message_id = ?", t.queue, msg.ID).First(&md).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		history, err := appendError(md.Errors, cause)
+		if err != nil {
+			return err
+		}
+
+		return t.moveToDeadLetter(tx, msg, md.Attempts+1, history)
+	})
+}
+
+// 処理に成功したメッセージの試行記録を消す
+func (t *Tracker) Clear(ctx context.Context, msgID string) error {
+	return t.db.WithContext(ctx).Delete(&model.MessageDelivery{}, "queue = ? AND message_id = ?", t.queue, msgID).Error
+}
+
+// 処理の失敗を記録し、試行回数が上限に達したメッセージを dead letter に移してキューから削除する
+func (t *Tracker) Fail(ctx context.Context, mqc simplemq.SimpleMQ, msg *simplemq.Message, cause error) error {
+	deadLettered, err := t.RecordFailure(ctx, msg, cause)
+	if err != nil {
+		return err
+	}
+
+	if !deadLettered {
+		return nil
+	}
+
+	slog.Warn("Message exceeded the delivery attempt limit, moved to dead letters", logging.KeyMsgID, msg.ID)
+
+	return mqc.DeleteMessage(ctx, msg.ID)
+}
+
+// 再試行しても処理できないメッセージを dead letter に移してキューから削除する
+func (t *Tracker) Discard(ctx context.Context, mqc simplemq.SimpleMQ, msg *simplemq.Message, cause error) error {
+	if err := t.DeadLetter(ctx, msg, cause); err != nil {
+		return err
+	}
+
+	slog.Warn("Message moved to dead letters", logging.KeyMsgID, msg.ID, logging.Err(cause))
+
+	return mqc.DeleteMessage(ctx, msg.ID)
+}
@@ -0,0 +1,132 @@
+package deck
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrDeckNotFound = errors.New("deck not found")
+)
+
+// デッキを構成するカード
+type Card struct {
+	CardId   string
+	Name     string
+	Count    uint
+	Category string
+}
+
+const (
+	CategoryPokemon   = "pokemon"
+	CategoryGoods     = "goods"
+	CategoryTool      = "tool"
+	CategoryTechnical = "technical_machine"
+	CategorySupporter = "supporter"
+	CategoryStadium   = "stadium"
+	CategoryEnergy    = "energy"
+	CategoryAceSpec   = "ace_spec"
+)
+
+// デッキページの hidden input の name とカテゴリの対応
+// ページには deck_ で始まる他の input (デッキコードなど) もあるので、ここにない name は読まない
+var categories = map[string]string{
+	"deck_pke":  CategoryPokemon,
+	"deck_gds":  CategoryGoods,
+	"deck_tool": CategoryTool,
+	"deck_tech": CategoryTechnical,
+	"deck_sup":  CategorySupporter,
+	"deck_sta":  CategoryStadium,
+	"deck_ene":  CategoryEnergy,
+	"deck_ajs":  CategoryAceSpec,
+}
+
+// カテゴリの出力順
+var categoryOrder = []string{"deck_pke", "deck_gds", "deck_tool", "deck_tech", "deck_sup", "deck_sta", "deck_ene", "deck_ajs"}
+
+var (
+	inputTagPattern  = regexp.MustCompile(`(?is)<input\b[^>]*>`)
+	attrPattern      = regexp.MustCompile(`(?is)\b(name|value)\s*=\s*"([^"]*)"`)
+	cardNamePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`PCGDECK\.searchItemNameAlt\[(\d+)\]\s*=\s*'((?:[^'\\]|\\.)*)'`),
+		regexp.MustCompile(`PCGDECK\.searchItemName\[(\d+)\]\s*=\s*'((?:[^'\\]|\\.)*)'`),
+	}
+)
+
+// 公式サイトのデッキページ (deck/confirm.html) からカードの構成を取り出す
+// カードは hidden input (deck_pke など) に "{カードID}_{枚数}_{連番}" を "-" で繋いだ形で、
+// カード名は PCGDECK.searchItemNameAlt[{カードID}] に埋め込まれている
+func ParseDeckPage(r io.Reader) ([]*Card, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	page := string(b)
+
+	values := map[string]string{}
+	for _, tag := range inputTagPattern.FindAllString(page, -1) {
+		var name, value string
+		for _, m := range attrPattern.FindAllStringSubmatch(tag, -1) {
+			switch strings.ToLower(m[1]) {
+			case "name":
+				name = m[2]
+			case "value":
+				value = m[2]
+			}
+		}
+
+		if _, ok := categories[name]; ok {
+			values[name] = html.UnescapeString(value)
+		}
+	}
+
+	names := map[string]string{}
+	for _, p := range cardNamePatterns {
+		for _, m := range p.FindAllStringSubmatch(page, -1) {
+			if _, ok := names[m[1]]; ok {
+				continue
+			}
+			names[m[1]] = html.UnescapeString(strings.ReplaceAll(m[2], `\'`, `'`))
+		}
+	}
+
+	cards := []*Card{}
+	for _, name := range categoryOrder {
+		value, ok := values[name]
+		if !ok || value == "" {
+			continue
+		}
+
+		category := categories[name]
+
+		for _, entry := range strings.Split(value, "-") {
+			fields := strings.Split(entry, "_")
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("malformed %s entry %q", name, entry)
+			}
+
+			count, err := strconv.ParseUint(fields[1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("malformed %s entry %q: %w", name, entry, err)
+			}
+
+			cards = append(cards, &Card{
+				CardId:   fields[0],
+				Name:     names[fields[0]],
+				Count:    uint(count),
+				Category: category,
+			})
+		}
+	}
+
+	if len(cards) == 0 {
+		return nil, ErrDeckNotFound
+	}
+
+	return cards, nil
+}
@@ -0,0 +1,87 @@
+package deck
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseDeckPage(t *testing.T) {
+	f, err := os.Open("testdata/confirm.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cards, err := ParseDeckPage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// カテゴリの順に、ページに書かれた順で並ぶ
+	// deck_code や deck_regulation などのカテゴリ以外の input は読まない
+	want := []Card{
+		{CardId: "47013", Name: "リザードンex", Count: 3, Category: CategoryPokemon},
+		{CardId: "46512", Name: "ヒトカゲ", Count: 4, Category: CategoryPokemon},
+		{CardId: "46517", Name: "ピジョットex", Count: 2, Category: CategoryPokemon},
+		{CardId: "44997", Name: "ふしぎなアメ", Count: 4, Category: CategoryGoods},
+		{CardId: "45880", Name: "ナンジャモ", Count: 4, Category: CategorySupporter},
+		// searchItemNameAlt を優先し、HTML エスケープを戻す
+		{CardId: "46031", Name: "ボスの指令（ゲーチス）", Count: 2, Category: CategorySupporter},
+		{CardId: "45508", Name: "ジャッジマン&ホップ", Count: 1, Category: CategorySupporter},
+		{CardId: "46095", Name: "ボウルタウン", Count: 2, Category: CategoryStadium},
+		{CardId: "44000", Name: "基本炎エネルギー", Count: 6, Category: CategoryEnergy},
+		{CardId: "46611", Name: "プライムキャッチャー", Count: 1, Category: CategoryAceSpec},
+	}
+
+	if len(cards) != len(want) {
+		t.Fatalf("len(cards) = %d, want %d", len(cards), len(want))
+	}
+	for i, c := range cards {
+		if *c != want[i] {
+			t.Errorf("cards[%d] = %+v, want %+v", i, *c, want[i])
+		}
+	}
+}
+
+func TestParseDeckPageInvalid(t *testing.T) {
+	cases := []struct {
+		name    string
+		page    string
+		wantErr error
+	}{
+		{
+			"no deck inputs",
+			`<html><body><p>デッキが見つかりません</p></body></html>`,
+			ErrDeckNotFound,
+		},
+		{
+			"empty categories",
+			`<input type="hidden" name="deck_pke" value=""><input type="hidden" name="deck_code" value="kVvkkF-abc123-FFkV1F">`,
+			ErrDeckNotFound,
+		},
+		{
+			"entry without count",
+			`<input type="hidden" name="deck_pke" value="47013">`,
+			nil,
+		},
+		{
+			"non-numeric count",
+			`<input type="hidden" name="deck_pke" value="47013_x_1">`,
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseDeckPage(strings.NewReader(tc.page))
+			if err == nil {
+				t.Fatal("ParseDeckPage succeeded, want error")
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("ParseDeckPage = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
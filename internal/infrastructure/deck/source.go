@@ -0,0 +1,82 @@
+package deck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type DeckSource interface {
+	GetDeckCards(ctx context.Context, deckCode string) ([]*Card, error)
+}
+
+// 公式サイトのデッキページからカードの構成を取得する
+type HTTPDeckSource struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewHTTPDeckSource(baseURL string) DeckSource {
+	return &HTTPDeckSource{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+}
+
+func (s *HTTPDeckSource) GetDeckCards(ctx context.Context, deckCode string) ([]*Card, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/deck/confirm.html/deckID/%s/", s.baseURL, deckCode),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrDeckNotFound
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+
+	return ParseDeckPage(res.Body)
+}
+
+// 保存済みのデッキページ ({dir}/{deckCode}.html) からカードの構成を取得する
+type FileDeckSource struct {
+	dir string
+}
+
+func NewFileDeckSource(dir string) DeckSource {
+	return &FileDeckSource{
+		dir: dir,
+	}
+}
+
+func (s *FileDeckSource) GetDeckCards(ctx context.Context, deckCode string) ([]*Card, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, deckCode+".html"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrDeckNotFound
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseDeckPage(f)
+}
@@ -0,0 +1,113 @@
+package eventresult
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type EventResultSource interface {
+	GetEventResults(ctx context.Context, eventId uint) ([]*EventResult, error)
+}
+
+type EventResultDetailSearch struct {
+	Code    uint           `json:"code"`
+	Count   uint           `json:"count"`
+	Results []*EventResult `json:"results"`
+}
+
+type EventResult struct {
+	PlayerId string `json:"player_id"`
+	Name     string `json:"name"`
+	Rank     uint   `json:"rank"`
+	Point    uint   `json:"point"`
+	DeckId   string `json:"deck_id"`
+}
+
+func decodeEventResults(r io.Reader) ([]*EventResult, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var eds EventResultDetailSearch
+	if err := json.Unmarshal(body, &eds); err != nil {
+		return nil, err
+	}
+
+	return eds.Results, nil
+}
+
+// 公式サイトから大会結果を取得する
+type HTTPEventResultSource struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewHTTPEventResultSource(baseURL string) EventResultSource {
+	return &HTTPEventResultSource{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+}
+
+func (s *HTTPEventResultSource) GetEventResults(ctx context.Context, eventId uint) ([]*EventResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/event_result_detail_search?event_holding_id=%d", s.baseURL, eventId),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return []*EventResult{}, nil
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+
+	return decodeEventResults(res.Body)
+}
+
+// 保存済みの event_result_detail_search のレスポンス ({dir}/{eventId}.json) から大会結果を取得する
+type FileEventResultSource struct {
+	dir string
+}
+
+func NewFileEventResultSource(dir string) EventResultSource {
+	return &FileEventResultSource{
+		dir: dir,
+	}
+}
+
+func (s *FileEventResultSource) GetEventResults(ctx context.Context, eventId uint) ([]*EventResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, fmt.Sprintf("%d.json", eventId)))
+	if err != nil {
+		// 公式サイトの404と同様に、記録がない場合は結果なしとして扱う
+		if errors.Is(err, os.ErrNotExist) {
+			return []*EventResult{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	return decodeEventResults(f)
+}
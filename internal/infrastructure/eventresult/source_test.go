@@ -0,0 +1,104 @@
+package eventresult
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testdata/512345.json に保存したレスポンスの内容
+var wantResults = []*EventResult{
+	{PlayerId: "3120000001", Name: "山田 太郎", Rank: 1, Point: 200, DeckId: "kVvkkF-abc123-FFkV1F"},
+	{PlayerId: "3120000002", Name: "佐藤 花子", Rank: 2, Point: 160, DeckId: ""},
+	{PlayerId: "3120000003", Name: "鈴木 一郎", Rank: 3, Point: 120, DeckId: "gg3QLn-def456-nQ3LgL"},
+}
+
+func TestFileEventResultSource(t *testing.T) {
+	src := NewFileEventResultSource("testdata")
+
+	results, err := src.GetEventResults(context.Background(), 512345)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Errorf("GetEventResults(512345) = %v, want %v", results, wantResults)
+	}
+
+	// 保存されていないイベントは結果なし
+	results, err = src.GetEventResults(context.Background(), 1)
+	if err != nil || results == nil || len(results) != 0 {
+		t.Errorf("GetEventResults(1) = %v, %v, want an empty result", results, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := src.GetEventResults(ctx, 512345); err == nil {
+		t.Error("GetEventResults() with a canceled context succeeded")
+	}
+}
+
+func TestFileEventResultSourceBrokenFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "1.json"), []byte(`{"results":[`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileEventResultSource(dir).GetEventResults(context.Background(), 1); err == nil {
+		t.Error("GetEventResults() of a truncated file succeeded")
+	}
+}
+
+func TestHTTPEventResultSource(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/512345.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/event_result_detail_search" {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.URL.Query().Get("event_holding_id") {
+		case "512345":
+			w.Write(fixture)
+		case "500":
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+		case "501":
+			w.Write([]byte("<html>maintenance</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	src := NewHTTPEventResultSource(srv.URL + "/")
+
+	tests := []struct {
+		eventId uint
+		want    []*EventResult
+		wantErr bool
+	}{
+		{eventId: 512345, want: wantResults},
+		// 結果が公開されていないイベントは404になる
+		{eventId: 1, want: []*EventResult{}},
+		{eventId: 500, wantErr: true},
+		{eventId: 501, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		results, err := src.GetEventResults(context.Background(), tt.eventId)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("GetEventResults(%d) error = %v, wantErr %v", tt.eventId, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(results, tt.want) {
+			t.Errorf("GetEventResults(%d) = %v, want %v", tt.eventId, results, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package imagestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	awsHttp "github.com/aws/smithy-go/transport/http"
+)
+
+// S3 互換のオブジェクトストレージに画像を保存する
+type S3ImageStore struct {
+	client *s3.Client
+	bucket string
+}
+
+func NewS3ImageStore(ctx context.Context, endpoint, bucket string) (ImageStore, error) {
+	cfg, err := awsConfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(cfg, func(options *s3.Options) {
+		options.BaseEndpoint = aws.String(endpoint)
+	})
+
+	return &S3ImageStore{
+		client: client,
+		bucket: bucket,
+	}, nil
+}
+
+func isNotFound(err error) bool {
+	var noKey *types.NoSuchKey
+	if errors.As(err, &noKey) {
+		return true
+	}
+
+	// HeadObject はボディがないため NotFound または 404 のレスポンスとして返る
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return true
+	}
+
+	var resErr *awsHttp.ResponseError
+	return errors.As(err, &resErr) && resErr.HTTPStatusCode() == http.StatusNotFound
+}
+
+func (s *S3ImageStore) Exists(ctx context.Context, key string) (bool, error) {
+	if _, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *S3ImageStore) Put(ctx context.Context, key string, body []byte, meta Metadata) error {
+	input := &s3.PutObjectInput{
+		ACL:    types.ObjectCannedACLPublicRead,
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(body),
+	}
+
+	if meta.ContentType != "" {
+		input.ContentType = aws.String(meta.ContentType)
+	}
+
+	if meta.CacheControl != "" {
+		input.CacheControl = aws.String(meta.CacheControl)
+	}
+
+	_, err := s.client.PutObject(ctx, input)
+
+	return err
+}
+
+func (s *S3ImageStore) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	return io.ReadAll(out.Body)
+}
+
+func (s *S3ImageStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+
+	return err
+}
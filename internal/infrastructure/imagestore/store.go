@@ -0,0 +1,25 @@
+package imagestore
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+)
+
+// 保存する画像のメタデータ
+type Metadata struct {
+	ContentType  string
+	CacheControl string
+}
+
+type ImageStore interface {
+	// key の画像が保存済みかを返す (本体はダウンロードしない)
+	Exists(ctx context.Context, key string) (bool, error)
+	Put(ctx context.Context, key string, body []byte, meta Metadata) error
+	// key の画像がない場合は ErrNotFound を返す
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
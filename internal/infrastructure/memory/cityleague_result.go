@@ -0,0 +1,165 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+type resultKey struct {
+	cityleagueScheduleId string
+	officialEventId      uint
+	playerId             string
+}
+
+func newResultKey(r *model.CityleagueResult) resultKey {
+	return resultKey{r.CityleagueScheduleId, r.OfficialEventId, r.PlayerId}
+}
+
+type ResultRepository struct {
+	mu      sync.RWMutex
+	results map[resultKey]*model.CityleagueResult
+}
+
+func NewResultRepository() repository.ResultRepository {
+	return &ResultRepository{
+		results: map[resultKey]*model.CityleagueResult{},
+	}
+}
+
+func (r *ResultRepository) FindByOfficialEventId(ctx context.Context, officialEventId uint) ([]*model.CityleagueResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := []*model.CityleagueResult{}
+	for _, m := range r.results {
+		if m.OfficialEventId == officialEventId {
+			c := *m
+			results = append(results, &c)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank < results[j].Rank
+		}
+		return results[i].PlayerId < results[j].PlayerId
+	})
+
+	return results, nil
+}
+
+func (r *ResultRepository) upsert(results []*model.CityleagueResult, policy repository.ConflictPolicy) {
+	for _, m := range repository.UniqueResults(results) {
+		k := newResultKey(m)
+		if existing, ok := r.results[k]; ok {
+			if policy == repository.ConflictIgnore {
+				continue
+			}
+
+			existing.Rank = m.Rank
+			existing.Point = m.Point
+			existing.PlayerName = m.PlayerName
+			existing.DeckCode = m.DeckCode
+			if m.ArchetypeId != "" {
+				existing.ArchetypeId = m.ArchetypeId
+			}
+			continue
+		}
+
+		c := *m
+		r.results[k] = &c
+	}
+}
+
+func (r *ResultRepository) Upsert(ctx context.Context, results []*model.CityleagueResult, policy repository.ConflictPolicy) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.upsert(results, policy)
+
+	return nil
+}
+
+func (r *ResultRepository) ReplaceEvent(ctx context.Context, officialEventId uint, results []*model.CityleagueResult) (*repository.ReplaceStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var existing []*model.CityleagueResult
+	for _, m := range r.results {
+		if m.OfficialEventId == officialEventId {
+			existing = append(existing, m)
+		}
+	}
+	stats := repository.DiffResults(existing, results)
+
+	r.upsert(results, repository.ConflictUpdate)
+
+	keep := make(map[resultKey]struct{}, len(results))
+	for _, m := range results {
+		keep[newResultKey(m)] = struct{}{}
+	}
+
+	for k := range r.results {
+		if k.officialEventId != officialEventId {
+			continue
+		}
+		if _, ok := keep[k]; !ok {
+			delete(r.results, k)
+		}
+	}
+
+	return stats, nil
+}
+
+func (r *ResultRepository) FindDeckCodes(ctx context.Context) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := map[string]struct{}{}
+	deckCodes := []string{}
+	for _, m := range r.results {
+		if m.DeckCode == "" {
+			continue
+		}
+		if _, ok := seen[m.DeckCode]; ok {
+			continue
+		}
+		seen[m.DeckCode] = struct{}{}
+		deckCodes = append(deckCodes, m.DeckCode)
+	}
+
+	sort.Strings(deckCodes)
+
+	return deckCodes, nil
+}
+
+func (r *ResultRepository) UpdateArchetype(ctx context.Context, deckCode string, archetypeId string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var updated int64
+	for _, m := range r.results {
+		if m.DeckCode == deckCode && m.ArchetypeId != archetypeId {
+			m.ArchetypeId = archetypeId
+			updated++
+		}
+	}
+
+	return updated, nil
+}
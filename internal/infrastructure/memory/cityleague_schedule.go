@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+type ScheduleRepository struct {
+	mu        sync.RWMutex
+	schedules []*model.CityleagueSchedule
+}
+
+func NewScheduleRepository(schedules ...*model.CityleagueSchedule) repository.ScheduleRepository {
+	r := &ScheduleRepository{}
+	for _, cs := range schedules {
+		r.Add(cs)
+	}
+
+	return r
+}
+
+func (r *ScheduleRepository) Add(cs *model.CityleagueSchedule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := *cs
+	r.schedules = append(r.schedules, &c)
+
+	// Postgres の実装と同じく主キー順で最初に該当したものを返す
+	sort.Slice(r.schedules, func(i, j int) bool {
+		return r.schedules[i].ID < r.schedules[j].ID
+	})
+}
+
+func (r *ScheduleRepository) FindAll(ctx context.Context) ([]*model.CityleagueSchedule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schedules := make([]*model.CityleagueSchedule, 0, len(r.schedules))
+	for _, cs := range r.schedules {
+		c := *cs
+		schedules = append(schedules, &c)
+	}
+
+	return schedules, nil
+}
+
+func (r *ScheduleRepository) FindByDate(ctx context.Context, date time.Time) (*model.CityleagueSchedule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, cs := range r.schedules {
+		if !cs.FromDate.After(date) && !cs.ToDate.Before(date) {
+			c := *cs
+			return &c, nil
+		}
+	}
+
+	return nil, &repository.ScheduleNotFoundError{Date: date}
+}
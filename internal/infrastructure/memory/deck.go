@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+type DeckRepository struct {
+	mu    sync.RWMutex
+	decks map[string]*model.Deck
+	cards map[string][]*model.DeckCard
+}
+
+func NewDeckRepository() repository.DeckRepository {
+	return &DeckRepository{
+		decks: map[string]*model.Deck{},
+		cards: map[string][]*model.DeckCard{},
+	}
+}
+
+func (r *DeckRepository) Exists(ctx context.Context, code string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.decks[code]
+
+	return ok, nil
+}
+
+func (r *DeckRepository) FindCards(ctx context.Context, code string) ([]*model.DeckCard, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cards := make([]*model.DeckCard, 0, len(r.cards[code]))
+	for _, c := range r.cards[code] {
+		card := *c
+		cards = append(cards, &card)
+	}
+
+	return cards, nil
+}
+
+func (r *DeckRepository) Save(ctx context.Context, deck *model.Deck, cards []*model.DeckCard) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := *deck
+	r.decks[deck.Code] = &d
+
+	cs := make([]*model.DeckCard, 0, len(cards))
+	for _, c := range cards {
+		card := *c
+		cs = append(cs, &card)
+	}
+	r.cards[deck.Code] = cs
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+type DeckImageRepository struct {
+	mu     sync.RWMutex
+	images map[string]*model.DeckImage
+}
+
+func NewDeckImageRepository() repository.DeckImageRepository {
+	return &DeckImageRepository{
+		images: map[string]*model.DeckImage{},
+	}
+}
+
+func (r *DeckImageRepository) FindByKey(ctx context.Context, key string) (*model.DeckImage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	img, ok := r.images[key]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+
+	c := *img
+
+	return &c, nil
+}
+
+func (r *DeckImageRepository) FindAll(ctx context.Context) ([]*model.DeckImage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	imgs := make([]*model.DeckImage, 0, len(r.images))
+	for _, img := range r.images {
+		c := *img
+		imgs = append(imgs, &c)
+	}
+
+	sort.Slice(imgs, func(i, j int) bool {
+		if imgs[i].DeckCode != imgs[j].DeckCode {
+			return imgs[i].DeckCode < imgs[j].DeckCode
+		}
+		return imgs[i].Key < imgs[j].Key
+	})
+
+	return imgs, nil
+}
+
+func (r *DeckImageRepository) Save(ctx context.Context, img *model.DeckImage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := *img
+	r.images[img.Key] = &c
+
+	return nil
+}
+
+func (r *DeckImageRepository) MarkVerified(ctx context.Context, key string, verifiedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if img, ok := r.images[key]; ok {
+		img.VerifiedAt = &verifiedAt
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+type ImportRunRepository struct {
+	mu     sync.RWMutex
+	nextId uint
+	runs   map[uint]*model.ImportRun
+}
+
+func NewImportRunRepository() repository.ImportRunRepository {
+	return &ImportRunRepository{
+		nextId: 1,
+		runs:   map[uint]*model.ImportRun{},
+	}
+}
+
+func (r *ImportRunRepository) Create(ctx context.Context, run *model.ImportRun) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	run.ID = r.nextId
+	r.nextId++
+
+	c := *run
+	r.runs[run.ID] = &c
+
+	return nil
+}
+
+func (r *ImportRunRepository) Save(ctx context.Context, run *model.ImportRun) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := *run
+	r.runs[run.ID] = &c
+
+	return nil
+}
+
+func (r *ImportRunRepository) FindById(ctx context.Context, id uint) (*model.ImportRun, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	run, ok := r.runs[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+
+	c := *run
+
+	return &c, nil
+}
+
+func (r *ImportRunRepository) FindRecent(ctx context.Context, command string, limit int) ([]*model.ImportRun, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	runs := make([]*model.ImportRun, 0, len(r.runs))
+	for _, run := range r.runs {
+		if command != "" && run.Command != command {
+			continue
+		}
+		c := *run
+		runs = append(runs, &c)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].StartedAt.Equal(runs[j].StartedAt) {
+			return runs[i].StartedAt.After(runs[j].StartedAt)
+		}
+		return runs[i].ID > runs[j].ID
+	})
+
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	return runs, nil
+}
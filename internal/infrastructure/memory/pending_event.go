@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+type PendingEventRepository struct {
+	mu            sync.RWMutex
+	pendingEvents map[uint]*model.PendingEvent
+}
+
+func NewPendingEventRepository() repository.PendingEventRepository {
+	return &PendingEventRepository{
+		pendingEvents: map[uint]*model.PendingEvent{},
+	}
+}
+
+func (r *PendingEventRepository) FindAll(ctx context.Context) ([]*model.PendingEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pes := make([]*model.PendingEvent, 0, len(r.pendingEvents))
+	for _, pe := range r.pendingEvents {
+		c := *pe
+		pes = append(pes, &c)
+	}
+
+	sort.Slice(pes, func(i, j int) bool {
+		if !pes[i].EventDate.Equal(pes[j].EventDate) {
+			return pes[i].EventDate.Before(pes[j].EventDate)
+		}
+		return pes[i].OfficialEventId < pes[j].OfficialEventId
+	})
+
+	return pes, nil
+}
+
+func (r *PendingEventRepository) Save(ctx context.Context, pe *model.PendingEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	c := *pe
+	c.CreatedAt = now
+	if existing, ok := r.pendingEvents[pe.OfficialEventId]; ok {
+		c.CreatedAt = existing.CreatedAt
+	}
+	c.UpdatedAt = now
+	r.pendingEvents[pe.OfficialEventId] = &c
+
+	return nil
+}
+
+func (r *PendingEventRepository) Delete(ctx context.Context, officialEventId uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.pendingEvents, officialEventId)
+
+	return nil
+}
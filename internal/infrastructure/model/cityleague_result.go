@@ -14,6 +14,7 @@ type CityleagueResult struct {
 	Rank                 uint
 	Point                uint
 	DeckCode             string
+	ArchetypeId          string
 }
 
 func NewCityleagueResult(
@@ -26,6 +27,7 @@ func NewCityleagueResult(
 	rank uint,
 	point uint,
 	deckCode string,
+	archetypeId string,
 ) *CityleagueResult {
 	return &CityleagueResult{
 		CityleagueScheduleId: cityleagueScheduleId,
@@ -37,5 +39,6 @@ func NewCityleagueResult(
 		Rank:                 rank,
 		Point:                point,
 		DeckCode:             deckCode,
+		ArchetypeId:          archetypeId,
 	}
 }
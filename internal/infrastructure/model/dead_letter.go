@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+)
+
+// 処理できずにキューから取り除いたメッセージ
+type DeadLetter struct {
+	// メッセージを受信したキュー (deadletter.Queue*)
+	Queue     string `gorm:"primaryKey"`
+	MessageId string `gorm:"primaryKey"`
+	Content   string
+	Attempts  uint
+	Errors    string
+	CreatedAt time.Time
+}
+
+func NewDeadLetter(
+	queue string,
+	messageId string,
+	content string,
+	attempts uint,
+	errors string,
+) *DeadLetter {
+	return &DeadLetter{
+		Queue:     queue,
+		MessageId: messageId,
+		Content:   content,
+		Attempts:  attempts,
+		Errors:    errors,
+	}
+}
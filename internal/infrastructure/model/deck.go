@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+)
+
+// 公式サイトから取得したデッキ
+// CityleagueResult.DeckCode と Code で紐づく
+type Deck struct {
+	Code      string `gorm:"primaryKey"`
+	FetchedAt time.Time
+}
+
+// デッキを構成するカード
+type DeckCard struct {
+	DeckCode string `gorm:"primaryKey"`
+	Category string `gorm:"primaryKey"`
+	CardId   string `gorm:"primaryKey"`
+	Name     string
+	Count    uint
+}
+
+func NewDeck(
+	code string,
+	fetchedAt time.Time,
+) *Deck {
+	return &Deck{
+		Code:      code,
+		FetchedAt: fetchedAt,
+	}
+}
+
+func NewDeckCard(
+	deckCode string,
+	category string,
+	cardId string,
+	name string,
+	count uint,
+) *DeckCard {
+	return &DeckCard{
+		DeckCode: deckCode,
+		Category: category,
+		CardId:   cardId,
+		Name:     name,
+		Count:    count,
+	}
+}
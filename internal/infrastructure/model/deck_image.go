@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+)
+
+// 保存したデッキ画像のハッシュと寸法
+type DeckImage struct {
+	Key         string `gorm:"primaryKey"`
+	DeckCode    string
+	Rendition   string
+	ContentType string
+	// 保存した画像の SHA-256 (16進数)
+	Sha256 string
+	Size   int64
+	Width  int
+	Height int
+	// 変換元の公式サイトの画像の SHA-256 (16進数)
+	// 保存済みの画像から記録した場合は空になる
+	SourceSha256 string `gorm:"column:source_sha256"`
+	UploadedAt   time.Time
+	VerifiedAt   *time.Time
+}
+
+func NewDeckImage(
+	key string,
+	deckCode string,
+	rendition string,
+	contentType string,
+	sha256 string,
+	size int64,
+	width int,
+	height int,
+	sourceSha256 string,
+	uploadedAt time.Time,
+) *DeckImage {
+	return &DeckImage{
+		Key:          key,
+		DeckCode:     deckCode,
+		Rendition:    rendition,
+		ContentType:  contentType,
+		Sha256:       sha256,
+		Size:         size,
+		Width:        width,
+		Height:       height,
+		SourceSha256: sourceSha256,
+		UploadedAt:   uploadedAt,
+	}
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+)
+
+// dequeue や deckimages の1回の実行で処理した件数とエラー
+type ImportRun struct {
+	ID        uint `gorm:"primaryKey"`
+	Command   string
+	StartedAt time.Time
+	// 実行中、または途中で異常終了した場合は nil になる
+	EndedAt *time.Time
+	// シグナルを受けて処理を打ち切った場合は true になる
+	Interrupted       bool
+	MessagesProcessed int
+	EventsImported    int
+	RowsInserted      int
+	RowsUpdated       int
+	// 変更がなかったため書き込まなかった行
+	RowsUnchanged  int
+	RowsDeleted    int
+	ImagesEnqueued int
+	ImagesUploaded int
+	ErrorCount     int
+	// 発生したエラーの JSON 配列
+	Errors string
+}
+
+func NewImportRun(
+	command string,
+	startedAt time.Time,
+) *ImportRun {
+	return &ImportRun{
+		Command:   command,
+		StartedAt: startedAt,
+		Errors:    "[]",
+	}
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+// 処理に失敗したメッセージの配信試行回数とエラー履歴
+type MessageDelivery struct {
+	// メッセージを受信したキュー (deadletter.Queue*)
+	Queue     string `gorm:"primaryKey"`
+	MessageId string `gorm:"primaryKey"`
+	Attempts  uint
+	Errors    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
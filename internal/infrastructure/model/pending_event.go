@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+)
+
+// 開催期間が登録されていないため取り込みを保留しているイベント
+type PendingEvent struct {
+	OfficialEventId uint `gorm:"primaryKey"`
+	EventDate       time.Time
+	Content         string
+	Reason          string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func NewPendingEvent(
+	officialEventId uint,
+	eventDate time.Time,
+	content string,
+	reason string,
+) *PendingEvent {
+	return &PendingEvent{
+		OfficialEventId: officialEventId,
+		EventDate:       eventDate,
+		Content:         content,
+		Reason:          reason,
+	}
+}
@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 1文あたりの行数
+// 10列 × 1000行で Postgres のパラメータ数上限 (65535) に収まる
+const upsertBatchSize = 1000
+
+func onConflict(policy repository.ConflictPolicy) clause.OnConflict {
+	columns := []clause.Column{
+		{Name: "cityleague_schedule_id"},
+		{Name: "official_event_id"},
+		{Name: "player_id"},
+	}
+
+	switch policy {
+	case repository.ConflictIgnore:
+		return clause.OnConflict{
+			Columns:   columns,
+			DoNothing: true,
+		}
+	default:
+		return clause.OnConflict{
+			Columns: columns,
+			// アーキタイプは判定できた場合のみ更新し、判定ルールなしで再取り込みしても消えないようにする
+			DoUpdates: append(
+				clause.AssignmentColumns([]string{"rank", "point", "player_name", "deck_code"}),
+				clause.Assignment{
+					Column: clause.Column{Name: "archetype_id"},
+					Value:  gorm.Expr("COALESCE(NULLIF(excluded.archetype_id, ''), cityleague_results.archetype_id)"),
+				},
+			),
+			// 変更がない行は書き込まない
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Expr{SQL: "(cityleague_results.rank, cityleague_results.point, cityleague_results.player_name, cityleague_results.deck_code) IS DISTINCT FROM (excluded.rank, excluded.point, excluded.player_name, excluded.deck_code) OR (excluded.archetype_id <> '' AND excluded.archetype_id <> cityleague_results.archetype_id)"},
+			}},
+		}
+	}
+}
+
+type ResultRepository struct {
+	db *gorm.DB
+}
+
+func NewResultRepository(db *gorm.DB) repository.ResultRepository {
+	return &ResultRepository{
+		db: db,
+	}
+}
+
+func (r *ResultRepository) FindByOfficialEventId(ctx context.Context, officialEventId uint) ([]*model.CityleagueResult, error) {
+	var results []*model.CityleagueResult
+	if err := r.db.WithContext(ctx).
+		Where("official_event_id = ?", officialEventId).
+		Order("rank, player_id").
+		Find(&results).Error; err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func upsert(tx *gorm.DB, results []*model.CityleagueResult, policy repository.ConflictPolicy) error {
+	// 同じ主キーの行が1文に含まれると ON CONFLICT DO UPDATE が失敗する
+	rows := repository.UniqueResults(results)
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return tx.Clauses(onConflict(policy)).CreateInBatches(rows, upsertBatchSize).Error
+}
+
+func (r *ResultRepository) Upsert(ctx context.Context, results []*model.CityleagueResult, policy repository.ConflictPolicy) error {
+	return upsert(r.db.WithContext(ctx), results, policy)
+}
+
+// 1つのトランザクションで、変更された行は更新し、新しい成績に含まれない古い行は削除する
+func (r *ResultRepository) ReplaceEvent(ctx context.Context, officialEventId uint, results []*model.CityleagueResult) (*repository.ReplaceStats, error) {
+	var stats *repository.ReplaceStats
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []*model.CityleagueResult
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("official_event_id = ?", officialEventId).
+			Find(&existing).Error; err != nil {
+			return err
+		}
+		stats = repository.DiffResults(existing, results)
+
+		if err := upsert(tx, results, repository.ConflictUpdate); err != nil {
+			return err
+		}
+
+		playerIds := map[string][]string{}
+		for _, r := range results {
+			playerIds[r.CityleagueScheduleId] = append(playerIds[r.CityleagueScheduleId], r.PlayerId)
+		}
+
+		stale := tx.Where("official_event_id = ?", officialEventId)
+		for cityleagueScheduleId, ids := range playerIds {
+			stale = stale.Where("NOT (cityleague_schedule_id = ? AND player_id IN ?)", cityleagueScheduleId, ids)
+		}
+
+		return stale.Delete(&model.CityleagueResult{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func (r *ResultRepository) FindDeckCodes(ctx context.Context) ([]string, error) {
+	var deckCodes []string
+	if err := r.db.WithContext(ctx).
+		Model(&model.CityleagueResult{}).
+		Where("deck_code <> ''").
+		Distinct().
+		Order("deck_code").
+		Pluck("deck_code", &deckCodes).Error; err != nil {
+		return nil, err
+	}
+
+	return deckCodes, nil
+}
+
+func (r *ResultRepository) UpdateArchetype(ctx context.Context, deckCode string, archetypeId string) (int64, error) {
+	tx := r.db.WithContext(ctx).
+		Model(&model.CityleagueResult{}).
+		Where("deck_code = ? AND archetype_id <> ?", deckCode, archetypeId).
+		Update("archetype_id", archetypeId)
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+
+	return tx.RowsAffected, nil
+}
@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+	"gorm.io/gorm"
+)
+
+type ScheduleRepository struct {
+	db *gorm.DB
+}
+
+func NewScheduleRepository(db *gorm.DB) repository.ScheduleRepository {
+	return &ScheduleRepository{
+		db: db,
+	}
+}
+
+func (r *ScheduleRepository) FindAll(ctx context.Context) ([]*model.CityleagueSchedule, error) {
+	var schedules []*model.CityleagueSchedule
+	if err := r.db.WithContext(ctx).Order("from_date, id").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+func (r *ScheduleRepository) FindByDate(ctx context.Context, date time.Time) (*model.CityleagueSchedule, error) {
+	var cs model.CityleagueSchedule
+	if err := r.db.WithContext(ctx).Where("from_date <= ? AND to_date >= ?", date, date).First(&cs).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &repository.ScheduleNotFoundError{Date: date}
+		}
+		return nil, err
+	}
+
+	return &cs, nil
+}
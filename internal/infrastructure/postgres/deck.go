@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DeckRepository struct {
+	db *gorm.DB
+}
+
+func NewDeckRepository(db *gorm.DB) repository.DeckRepository {
+	return &DeckRepository{
+		db: db,
+	}
+}
+
+func (r *DeckRepository) Exists(ctx context.Context, code string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&model.Deck{}).Where("code = ?", code).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *DeckRepository) FindCards(ctx context.Context, code string) ([]*model.DeckCard, error) {
+	var cards []*model.DeckCard
+	if err := r.db.WithContext(ctx).Where("deck_code = ?", code).Order("category, card_id").Find(&cards).Error; err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+func (r *DeckRepository) Save(ctx context.Context, deck *model.Deck, cards []*model.DeckCard) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(deck).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&model.DeckCard{}, "deck_code = ?", deck.Code).Error; err != nil {
+			return err
+		}
+
+		if len(cards) == 0 {
+			return nil
+		}
+
+		return tx.Create(cards).Error
+	})
+}
@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DeckImageRepository struct {
+	db *gorm.DB
+}
+
+func NewDeckImageRepository(db *gorm.DB) repository.DeckImageRepository {
+	return &DeckImageRepository{
+		db: db,
+	}
+}
+
+func (r *DeckImageRepository) FindByKey(ctx context.Context, key string) (*model.DeckImage, error) {
+	var img model.DeckImage
+	if err := r.db.WithContext(ctx).Where("key = ?", key).First(&img).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &img, nil
+}
+
+func (r *DeckImageRepository) FindAll(ctx context.Context) ([]*model.DeckImage, error) {
+	var imgs []*model.DeckImage
+	if err := r.db.WithContext(ctx).Order("deck_code, key").Find(&imgs).Error; err != nil {
+		return nil, err
+	}
+
+	return imgs, nil
+}
+
+func (r *DeckImageRepository) Save(ctx context.Context, img *model.DeckImage) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"deck_code", "rendition", "content_type", "sha256", "size", "width", "height", "source_sha256", "uploaded_at", "verified_at",
+		}),
+	}).Create(img).Error
+}
+
+func (r *DeckImageRepository) MarkVerified(ctx context.Context, key string, verifiedAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.DeckImage{}).Where("key = ?", key).Update("verified_at", verifiedAt).Error
+}
@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+	"gorm.io/gorm"
+)
+
+type ImportRunRepository struct {
+	db *gorm.DB
+}
+
+func NewImportRunRepository(db *gorm.DB) repository.ImportRunRepository {
+	return &ImportRunRepository{
+		db: db,
+	}
+}
+
+func (r *ImportRunRepository) Create(ctx context.Context, run *model.ImportRun) error {
+	return r.db.WithContext(ctx).Create(run).Error
+}
+
+func (r *ImportRunRepository) Save(ctx context.Context, run *model.ImportRun) error {
+	return r.db.WithContext(ctx).Save(run).Error
+}
+
+func (r *ImportRunRepository) FindById(ctx context.Context, id uint) (*model.ImportRun, error) {
+	var run model.ImportRun
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&run).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+func (r *ImportRunRepository) FindRecent(ctx context.Context, command string, limit int) ([]*model.ImportRun, error) {
+	tx := r.db.WithContext(ctx)
+	if command != "" {
+		tx = tx.Where("command = ?", command)
+	}
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+
+	var runs []*model.ImportRun
+	if err := tx.Order("started_at DESC, id DESC").Find(&runs).Error; err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
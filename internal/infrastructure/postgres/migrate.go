@@ -0,0 +1,284 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// マイグレーションを直列に実行するためのアドバイザリロックのキー
+const migrationLockKey = 7274105
+
+// migrations/{version}_{name}.up.sql と .down.sql の組
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration *Migration
+	AppliedAt *time.Time
+}
+
+type SchemaMigration struct {
+	Version   uint `gorm:"primaryKey"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func LoadMigrations() ([]*Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("unexpected migration file %s", name)
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionStr, migrationName, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration file %s must be named {version}_{name}.%s.sql", name, direction)
+		}
+
+		version, err := strconv.ParseUint(versionStr, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %s: invalid version: %w", name, err)
+		}
+
+		b, err := migrationFiles.ReadFile("migrations/" + name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: migrationName}
+			byVersion[uint(version)] = m
+		}
+		if m.Name != migrationName {
+			return nil, fmt.Errorf("migration version %d has conflicting names %s and %s", version, m.Name, migrationName)
+		}
+
+		if direction == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []*Migration
+}
+
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	return m.db.WithContext(ctx).Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    bigint PRIMARY KEY,
+    name       text NOT NULL,
+    applied_at timestamptz NOT NULL
+)`).Error
+}
+
+func (m *Migrator) applied(tx *gorm.DB) (map[uint]SchemaMigration, error) {
+	var rows []SchemaMigration
+	if err := tx.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[uint]SchemaMigration, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		s := &MigrationStatus{Migration: migration}
+		if r, ok := applied[migration.Version]; ok {
+			appliedAt := r.AppliedAt
+			s.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, s)
+	}
+
+	return statuses, nil
+}
+
+// マイグレーションを1つずつトランザクション内で実行する
+// fn が false を返した場合は何もせずに終了する
+func (m *Migrator) step(ctx context.Context, fn func(tx *gorm.DB, applied map[uint]SchemaMigration) (bool, error)) (bool, error) {
+	done := false
+
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockKey).Error; err != nil {
+			return err
+		}
+
+		applied, err := m.applied(tx)
+		if err != nil {
+			return err
+		}
+
+		ok, err := fn(tx, applied)
+		if err != nil {
+			return err
+		}
+		done = !ok
+
+		return nil
+	})
+
+	return done, err
+}
+
+// 未適用のマイグレーションを古い順に最大 n 件適用する (n が 0 の場合はすべて)
+func (m *Migrator) Up(ctx context.Context, n int) ([]*Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	var migrated []*Migration
+	for n == 0 || len(migrated) < n {
+		// コミットに失敗したマイグレーションを適用済みとして返さないよう、コミット後に追加する
+		var current *Migration
+		done, err := m.step(ctx, func(tx *gorm.DB, applied map[uint]SchemaMigration) (bool, error) {
+			for _, migration := range m.migrations {
+				if _, ok := applied[migration.Version]; ok {
+					continue
+				}
+
+				if err := tx.Exec(migration.Up).Error; err != nil {
+					return false, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+				}
+
+				if err := tx.Create(&SchemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now(),
+				}).Error; err != nil {
+					return false, err
+				}
+
+				current = migration
+				return true, nil
+			}
+
+			return false, nil
+		})
+		if err != nil {
+			return migrated, err
+		}
+		if done {
+			break
+		}
+		migrated = append(migrated, current)
+	}
+
+	return migrated, nil
+}
+
+// 適用済みのマイグレーションを新しい順に n 件戻す
+func (m *Migrator) Down(ctx context.Context, n int) ([]*Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	var migrated []*Migration
+	for len(migrated) < n {
+		// コミットに失敗したマイグレーションを戻したものとして返さないよう、コミット後に追加する
+		var current *Migration
+		done, err := m.step(ctx, func(tx *gorm.DB, applied map[uint]SchemaMigration) (bool, error) {
+			for i := len(m.migrations) - 1; i >= 0; i-- {
+				migration := m.migrations[i]
+				if _, ok := applied[migration.Version]; !ok {
+					continue
+				}
+
+				if err := tx.Exec(migration.Down).Error; err != nil {
+					return false, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+				}
+
+				if err := tx.Delete(&SchemaMigration{}, "version = ?", migration.Version).Error; err != nil {
+					return false, err
+				}
+
+				current = migration
+				return true, nil
+			}
+
+			return false, nil
+		})
+		if err != nil {
+			return migrated, err
+		}
+		if done {
+			break
+		}
+		migrated = append(migrated, current)
+	}
+
+	return migrated, nil
+}
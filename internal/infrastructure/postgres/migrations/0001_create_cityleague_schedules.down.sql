@@ -0,0 +1,2 @@
+-- 既存の環境から取り込んだテーブルで、適用前からのデータが入っているため削除しない
+SELECT 1;
@@ -0,0 +1,11 @@
+-- 既存の環境ではテーブルが作成済みのため IF NOT EXISTS で取り込む
+CREATE TABLE IF NOT EXISTS cityleague_schedules (
+    id        text PRIMARY KEY,
+    title     text NOT NULL,
+    from_date timestamptz NOT NULL,
+    to_date   timestamptz NOT NULL,
+    CONSTRAINT cityleague_schedules_date_range_check CHECK (from_date <= to_date)
+);
+
+CREATE INDEX IF NOT EXISTS cityleague_schedules_from_date_to_date_idx
+    ON cityleague_schedules (from_date, to_date);
@@ -0,0 +1,20 @@
+-- 既存の環境ではテーブルが作成済みのため IF NOT EXISTS で取り込む
+CREATE TABLE IF NOT EXISTS cityleague_results (
+    cityleague_schedule_id text NOT NULL REFERENCES cityleague_schedules (id),
+    official_event_id      bigint NOT NULL,
+    league_type            bigint NOT NULL,
+    event_date             timestamptz NOT NULL,
+    player_id              text NOT NULL,
+    player_name            text NOT NULL,
+    rank                   bigint NOT NULL,
+    point                  bigint NOT NULL,
+    deck_code              text NOT NULL DEFAULT '',
+    PRIMARY KEY (cityleague_schedule_id, official_event_id, player_id)
+);
+
+CREATE INDEX IF NOT EXISTS cityleague_results_official_event_id_idx
+    ON cityleague_results (official_event_id);
+
+CREATE INDEX IF NOT EXISTS cityleague_results_deck_code_idx
+    ON cityleague_results (deck_code)
+    WHERE deck_code <> '';
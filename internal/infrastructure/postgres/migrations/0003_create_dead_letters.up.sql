@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS message_deliveries (
+    message_id text PRIMARY KEY,
+    attempts   bigint NOT NULL DEFAULT 0,
+    errors     text NOT NULL DEFAULT '[]',
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS dead_letters (
+    message_id text PRIMARY KEY,
+    content    text NOT NULL,
+    attempts   bigint NOT NULL,
+    errors     text NOT NULL,
+    created_at timestamptz NOT NULL
+);
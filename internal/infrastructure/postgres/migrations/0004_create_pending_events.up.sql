@@ -0,0 +1,11 @@
+CREATE TABLE pending_events (
+    official_event_id bigint PRIMARY KEY,
+    event_date        timestamptz NOT NULL,
+    content           text NOT NULL,
+    reason            text NOT NULL,
+    created_at        timestamptz NOT NULL,
+    updated_at        timestamptz NOT NULL
+);
+
+CREATE INDEX pending_events_event_date_idx
+    ON pending_events (event_date);
@@ -0,0 +1,16 @@
+CREATE TABLE decks (
+    code       text PRIMARY KEY,
+    fetched_at timestamptz NOT NULL
+);
+
+CREATE TABLE deck_cards (
+    deck_code text NOT NULL REFERENCES decks (code) ON DELETE CASCADE,
+    category  text NOT NULL,
+    card_id   text NOT NULL,
+    name      text NOT NULL,
+    count     bigint NOT NULL CHECK (count > 0),
+    PRIMARY KEY (deck_code, category, card_id)
+);
+
+CREATE INDEX deck_cards_card_id_idx
+    ON deck_cards (card_id);
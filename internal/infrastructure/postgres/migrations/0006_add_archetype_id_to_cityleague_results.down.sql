@@ -0,0 +1,2 @@
+ALTER TABLE cityleague_results
+    DROP COLUMN IF EXISTS archetype_id;
@@ -0,0 +1,6 @@
+ALTER TABLE cityleague_results
+    ADD COLUMN archetype_id text NOT NULL DEFAULT '';
+
+CREATE INDEX cityleague_results_archetype_id_idx
+    ON cityleague_results (archetype_id)
+    WHERE archetype_id <> '';
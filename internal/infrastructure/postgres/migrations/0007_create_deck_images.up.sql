@@ -0,0 +1,16 @@
+CREATE TABLE deck_images (
+    key           text PRIMARY KEY,
+    deck_code     text NOT NULL,
+    rendition     text NOT NULL,
+    content_type  text NOT NULL,
+    sha256        text NOT NULL,
+    size          bigint NOT NULL,
+    width         bigint NOT NULL,
+    height        bigint NOT NULL,
+    source_sha256 text NOT NULL,
+    uploaded_at   timestamptz NOT NULL,
+    verified_at   timestamptz
+);
+
+CREATE INDEX deck_images_deck_code_idx
+    ON deck_images (deck_code);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS import_runs (
+    id                 bigserial PRIMARY KEY,
+    command            text NOT NULL,
+    started_at         timestamptz NOT NULL,
+    ended_at           timestamptz,
+    interrupted        boolean NOT NULL DEFAULT false,
+    messages_processed bigint NOT NULL DEFAULT 0,
+    events_imported    bigint NOT NULL DEFAULT 0,
+    rows_inserted      bigint NOT NULL DEFAULT 0,
+    rows_updated       bigint NOT NULL DEFAULT 0,
+    rows_unchanged     bigint NOT NULL DEFAULT 0,
+    rows_deleted       bigint NOT NULL DEFAULT 0,
+    images_enqueued    bigint NOT NULL DEFAULT 0,
+    images_uploaded    bigint NOT NULL DEFAULT 0,
+    error_count        bigint NOT NULL DEFAULT 0,
+    errors             text NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX IF NOT EXISTS import_runs_command_started_at_idx
+    ON import_runs (command, started_at DESC);
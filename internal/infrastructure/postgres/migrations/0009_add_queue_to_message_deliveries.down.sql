@@ -0,0 +1,12 @@
+-- 別々のキューに同じメッセージIDの記録がある場合は主キーを戻せないので、最新の1件だけを残す
+DELETE FROM dead_letters a USING dead_letters b
+WHERE a.message_id = b.message_id AND (a.created_at, a.queue) < (b.created_at, b.queue);
+ALTER TABLE dead_letters DROP CONSTRAINT IF EXISTS dead_letters_pkey;
+ALTER TABLE dead_letters DROP COLUMN IF EXISTS queue;
+ALTER TABLE dead_letters ADD PRIMARY KEY (message_id);
+
+DELETE FROM message_deliveries a USING message_deliveries b
+WHERE a.message_id = b.message_id AND (a.updated_at, a.queue) < (b.updated_at, b.queue);
+ALTER TABLE message_deliveries DROP CONSTRAINT IF EXISTS message_deliveries_pkey;
+ALTER TABLE message_deliveries DROP COLUMN IF EXISTS queue;
+ALTER TABLE message_deliveries ADD PRIMARY KEY (message_id);
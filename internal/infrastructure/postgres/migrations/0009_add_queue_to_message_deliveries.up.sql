@@ -0,0 +1,10 @@
+-- dequeue と deckimages のキューの記録を区別する
+-- 追加前の記録はどちらのキューのものか分からないので、行は残して queue を空文字列にする
+-- 空文字列のキューから受信することはないので、追加前の試行回数は数え直しになる
+ALTER TABLE message_deliveries ADD COLUMN IF NOT EXISTS queue text NOT NULL DEFAULT '';
+ALTER TABLE message_deliveries DROP CONSTRAINT IF EXISTS message_deliveries_pkey;
+ALTER TABLE message_deliveries ADD PRIMARY KEY (queue, message_id);
+
+ALTER TABLE dead_letters ADD COLUMN IF NOT EXISTS queue text NOT NULL DEFAULT '';
+ALTER TABLE dead_letters DROP CONSTRAINT IF EXISTS dead_letters_pkey;
+ALTER TABLE dead_letters ADD PRIMARY KEY (queue, message_id);
@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PendingEventRepository struct {
+	db *gorm.DB
+}
+
+func NewPendingEventRepository(db *gorm.DB) repository.PendingEventRepository {
+	return &PendingEventRepository{
+		db: db,
+	}
+}
+
+func (r *PendingEventRepository) FindAll(ctx context.Context) ([]*model.PendingEvent, error) {
+	var pes []*model.PendingEvent
+	if err := r.db.WithContext(ctx).Order("event_date, official_event_id").Find(&pes).Error; err != nil {
+		return nil, err
+	}
+
+	return pes, nil
+}
+
+func (r *PendingEventRepository) Save(ctx context.Context, pe *model.PendingEvent) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "official_event_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"event_date", "content", "reason", "updated_at"}),
+	}).Create(pe).Error
+}
+
+func (r *PendingEventRepository) Delete(ctx context.Context, officialEventId uint) error {
+	return r.db.WithContext(ctx).Delete(&model.PendingEvent{}, "official_event_id = ?", officialEventId).Error
+}
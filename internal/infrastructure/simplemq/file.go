@@ -0,0 +1,288 @@
+package simplemq
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	fileOpPut    = "put"
+	fileOpDelete = "delete"
+
+	// ログの行数がこの値と生存メッセージ数の2倍の合計を超えたらコンパクションする
+	fileCompactionThreshold = 1000
+)
+
+type fileRecord struct {
+	Op                  string `json:"op"`
+	ID                  string `json:"id"`
+	Content             string `json:"content,omitempty"`
+	CreatedAt           int64  `json:"created_at,omitempty"`
+	UpdatedAt           int64  `json:"updated_at,omitempty"`
+	ExpiresAt           int64  `json:"expires_at,omitempty"`
+	AcquiredAt          int64  `json:"acquired_at,omitempty"`
+	VisibilityTimeoutAt int64  `json:"visibility_timeout_at,omitempty"`
+}
+
+func newPutRecord(m *Message) *fileRecord {
+	unixMilli := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+		return t.UnixMilli()
+	}
+
+	return &fileRecord{
+		Op:                  fileOpPut,
+		ID:                  m.ID,
+		Content:             m.Content,
+		CreatedAt:           unixMilli(m.CreatedAt),
+		UpdatedAt:           unixMilli(m.UpdatedAt),
+		ExpiresAt:           unixMilli(m.ExpiresAt),
+		AcquiredAt:          unixMilli(m.AcquiredAt),
+		VisibilityTimeoutAt: unixMilli(m.VisibilityTimeoutAt),
+	}
+}
+
+func (r *fileRecord) message() *Message {
+	fromUnixMilli := func(ms int64) time.Time {
+		if ms == 0 {
+			return time.Time{}
+		}
+		return time.UnixMilli(ms)
+	}
+
+	return &Message{
+		ID:                  r.ID,
+		Content:             r.Content,
+		CreatedAt:           fromUnixMilli(r.CreatedAt),
+		UpdatedAt:           fromUnixMilli(r.UpdatedAt),
+		ExpiresAt:           fromUnixMilli(r.ExpiresAt),
+		AcquiredAt:          fromUnixMilli(r.AcquiredAt),
+		VisibilityTimeoutAt: fromUnixMilli(r.VisibilityTimeoutAt),
+	}
+}
+
+// 追記型のログファイルにメッセージを永続化する SimpleMQ の実装
+// 操作のたびにロックを取ってログを読み直すため、複数プロセスから同じファイルを共有できる
+type FileMQ struct {
+	path              string
+	visibilityTimeout time.Duration
+	retentionPeriod   time.Duration
+}
+
+func NewFileMQ(path string, visibilityTimeout, retentionPeriod time.Duration) SimpleMQ {
+	return &FileMQ{
+		path:              path,
+		visibilityTimeout: visibilityTimeout,
+		retentionPeriod:   retentionPeriod,
+	}
+}
+
+// ロックを取得した状態でキューを復元し、fn の結果をログに追記する
+func (c *FileMQ) do(ctx context.Context, fn func(q *queue, now time.Time) ([]*fileRecord, error)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	lock, err := os.OpenFile(c.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	now := time.Now()
+
+	q, lines, err := c.load()
+	if err != nil {
+		return err
+	}
+	q.expire(now)
+
+	records, err := fn(q, now)
+	if err != nil {
+		return err
+	}
+
+	if lines+len(records) > fileCompactionThreshold+2*len(q.messages) {
+		return c.compact(q)
+	}
+
+	return c.append(records)
+}
+
+func (c *FileMQ) load() (*queue, int, error) {
+	q := newQueue(c.visibilityTimeout, c.retentionPeriod)
+
+	f, err := os.Open(c.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return q, 0, nil
+		}
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lines++
+
+		var r fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, 0, fmt.Errorf("%s:%d: %w", c.path, lines, err)
+		}
+
+		switch r.Op {
+		case fileOpPut:
+			if m := q.find(r.ID); m != nil {
+				*m = *r.message()
+			} else {
+				q.messages = append(q.messages, r.message())
+			}
+		case fileOpDelete:
+			_ = q.delete(r.ID)
+		default:
+			return nil, 0, fmt.Errorf("%s:%d: unknown op %q", c.path, lines, r.Op)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return q, lines, nil
+}
+
+func (c *FileMQ) append(records []*fileRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := writeRecords(f, records); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// 生存しているメッセージだけでログを書き直す
+func (c *FileMQ) compact(q *queue) error {
+	records := make([]*fileRecord, 0, len(q.messages))
+	for _, m := range q.messages {
+		records = append(records, newPutRecord(m))
+	}
+
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := writeRecords(f, records); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.path)
+}
+
+func writeRecords(f *os.File, records []*fileRecord) error {
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+func (c *FileMQ) SendMessage(ctx context.Context, msgReq *SendMessageRequest) (*SendMessageResponse, error) {
+	id, err := newMessageID()
+	if err != nil {
+		return nil, err
+	}
+
+	var msg Message
+	if err := c.do(ctx, func(q *queue, now time.Time) ([]*fileRecord, error) {
+		m := q.send(id, msgReq.Content, now)
+		msg = *m
+		return []*fileRecord{newPutRecord(m)}, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &SendMessageResponse{
+		Result:  "success",
+		Message: &msg,
+	}, nil
+}
+
+func (c *FileMQ) ReceiveMessage(ctx context.Context) (*ReceiveMessageResponse, error) {
+	ret := &ReceiveMessageResponse{
+		Result:   "success",
+		Messages: []*Message{},
+	}
+
+	if err := c.do(ctx, func(q *queue, now time.Time) ([]*fileRecord, error) {
+		m := q.receive(now)
+		if m == nil {
+			return nil, nil
+		}
+
+		msg := *m
+		ret.Messages = append(ret.Messages, &msg)
+		return []*fileRecord{newPutRecord(m)}, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (c *FileMQ) UpdateMessageTimeout(ctx context.Context, msgID string) error {
+	return c.do(ctx, func(q *queue, now time.Time) ([]*fileRecord, error) {
+		if err := q.update(msgID, now); err != nil {
+			return nil, err
+		}
+
+		return []*fileRecord{newPutRecord(q.find(msgID))}, nil
+	})
+}
+
+func (c *FileMQ) DeleteMessage(ctx context.Context, msgID string) error {
+	return c.do(ctx, func(q *queue, now time.Time) ([]*fileRecord, error) {
+		if err := q.delete(msgID); err != nil {
+			return nil, err
+		}
+
+		return []*fileRecord{{Op: fileOpDelete, ID: msgID}}, nil
+	})
+}
@@ -0,0 +1,139 @@
+package simplemq
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileMQ(t *testing.T) {
+	dir := t.TempDir()
+	n := 0
+
+	testLocalMQ(t, func(visibilityTimeout, retentionPeriod time.Duration) SimpleMQ {
+		n++
+		return NewFileMQ(filepath.Join(dir, fmt.Sprintf("%d.mq", n)), visibilityTimeout, retentionPeriod)
+	})
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+	}
+
+	return lines
+}
+
+func TestFileMQSharedBetweenProcesses(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "local.mq")
+
+	producer := NewFileMQ(path, time.Minute, time.Hour)
+	consumer := NewFileMQ(path, time.Minute, time.Hour)
+
+	for _, content := range []string{"1", "2"} {
+		if _, err := producer.SendMessage(ctx, &SendMessageRequest{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := consumer.ReceiveMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Messages) != 1 || res.Messages[0].Content != "1" {
+		t.Fatalf("ReceiveMessage() = %+v, want 1", res.Messages)
+	}
+
+	// 受信したことは別のインスタンスからも見える
+	res, err = producer.ReceiveMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Messages) != 1 || res.Messages[0].Content != "2" {
+		t.Fatalf("ReceiveMessage() = %+v, want 2", res.Messages)
+	}
+
+	if err := producer.DeleteMessage(ctx, res.Messages[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// put 2件、受信 2件、削除 1件
+	if got := countLines(t, path); got != 5 {
+		t.Errorf("log has %d lines, want 5", got)
+	}
+}
+
+func TestFileMQCompaction(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "local.mq")
+	mq := NewFileMQ(path, time.Minute, time.Hour)
+
+	kept, err := mq.SendMessage(ctx, &SendMessageRequest{Content: "kept"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 削除済みのメッセージと延長の記録でログを閾値まで膨らませる
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []*fileRecord
+	for i := 0; len(records) <= fileCompactionThreshold; i++ {
+		m := &Message{ID: "deleted", Content: "x", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+		records = append(records, newPutRecord(m), &fileRecord{Op: fileOpDelete, ID: m.ID})
+	}
+	if err := writeRecords(f, records); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if err := mq.UpdateMessageTimeout(ctx, kept.Message.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := countLines(t, path); got != 1 {
+		t.Errorf("log has %d lines after compaction, want 1", got)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file is left: %v", err)
+	}
+
+	// コンパクション後も延長した可視性タイムアウトが残っている
+	res, err := mq.ReceiveMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Messages) != 0 {
+		t.Errorf("ReceiveMessage() after compaction = %+v, want nothing visible", res.Messages)
+	}
+	if err := mq.DeleteMessage(ctx, kept.Message.ID); err != nil {
+		t.Errorf("DeleteMessage() after compaction error = %v", err)
+	}
+}
+
+func TestFileMQBrokenLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "local.mq")
+	if err := os.WriteFile(path, []byte(`{"op":"put","id":"a"}`+"\n"+`{"op":"rename","id":"a"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileMQ(path, time.Minute, time.Hour).ReceiveMessage(context.Background()); err == nil {
+		t.Error("ReceiveMessage() of a log with an unknown op succeeded")
+	}
+}
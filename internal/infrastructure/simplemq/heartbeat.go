@@ -0,0 +1,55 @@
+package simplemq
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+)
+
+// 処理中のメッセージの可視性タイムアウトを interval ごとに延長する
+// 返り値の関数を呼ぶか ctx がキャンセルされると延長を止める
+// 返り値の関数は延長処理の終了を待ってから戻るため、呼び出した後に DeleteMessage してよい
+func StartHeartbeat(ctx context.Context, mqc SimpleMQ, msgID string, interval time.Duration) func() {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := mqc.UpdateMessageTimeout(ctx, msgID); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				// 削除済みまたは期限切れのメッセージは延長できない
+				if errors.Is(err, ErrNotFound) {
+					slog.Warn("Message no longer exists, stopping heartbeat", logging.KeyMsgID, msgID)
+					return
+				}
+
+				// 一時的な失敗は次の周期で再試行する
+				slog.Warn("Failed to extend visibility timeout", logging.KeyMsgID, msgID, logging.Err(err))
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
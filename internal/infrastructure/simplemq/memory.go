@@ -0,0 +1,195 @@
+package simplemq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// SimpleMQ のデフォルト値に合わせる
+	DefaultVisibilityTimeout = 30 * time.Second
+	DefaultRetentionPeriod   = 4 * 24 * time.Hour
+)
+
+func newMessageID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// 到着順にメッセージを保持するキュー
+// MemoryMQ と FileMQ で共有する
+type queue struct {
+	visibilityTimeout time.Duration
+	retentionPeriod   time.Duration
+	messages          []*Message
+}
+
+func newQueue(visibilityTimeout, retentionPeriod time.Duration) *queue {
+	return &queue{
+		visibilityTimeout: visibilityTimeout,
+		retentionPeriod:   retentionPeriod,
+		messages:          []*Message{},
+	}
+}
+
+func (q *queue) find(msgID string) *Message {
+	for _, m := range q.messages {
+		if m.ID == msgID {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func (q *queue) send(id, content string, now time.Time) *Message {
+	m := &Message{
+		ID:        id,
+		Content:   content,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(q.retentionPeriod),
+	}
+	q.messages = append(q.messages, m)
+
+	return m
+}
+
+// 保持期限切れのメッセージを取り除く
+func (q *queue) expire(now time.Time) {
+	messages := q.messages[:0]
+	for _, m := range q.messages {
+		if now.Before(m.ExpiresAt) {
+			messages = append(messages, m)
+		}
+	}
+	q.messages = messages
+}
+
+// 可視状態の先頭メッセージを取得し、可視性タイムアウトを設定する
+func (q *queue) receive(now time.Time) *Message {
+	q.expire(now)
+
+	for _, m := range q.messages {
+		if now.Before(m.VisibilityTimeoutAt) {
+			continue
+		}
+
+		m.AcquiredAt = now
+		m.UpdatedAt = now
+		m.VisibilityTimeoutAt = now.Add(q.visibilityTimeout)
+
+		return m
+	}
+
+	return nil
+}
+
+func (q *queue) update(msgID string, now time.Time) error {
+	q.expire(now)
+
+	m := q.find(msgID)
+	if m == nil {
+		return ErrNotFound
+	}
+
+	m.UpdatedAt = now
+	m.VisibilityTimeoutAt = now.Add(q.visibilityTimeout)
+
+	return nil
+}
+
+func (q *queue) delete(msgID string) error {
+	for i, m := range q.messages {
+		if m.ID == msgID {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// プロセス内で完結する SimpleMQ の実装
+type MemoryMQ struct {
+	mu    sync.Mutex
+	queue *queue
+}
+
+func NewMemoryMQ(visibilityTimeout, retentionPeriod time.Duration) SimpleMQ {
+	return &MemoryMQ{
+		queue: newQueue(visibilityTimeout, retentionPeriod),
+	}
+}
+
+func (c *MemoryMQ) SendMessage(ctx context.Context, msgReq *SendMessageRequest) (*SendMessageResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	id, err := newMessageID()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.queue.send(id, msgReq.Content, time.Now())
+	msg := *m
+
+	return &SendMessageResponse{
+		Result:  "success",
+		Message: &msg,
+	}, nil
+}
+
+func (c *MemoryMQ) ReceiveMessage(ctx context.Context) (*ReceiveMessageResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ret := &ReceiveMessageResponse{
+		Result:   "success",
+		Messages: []*Message{},
+	}
+
+	if m := c.queue.receive(time.Now()); m != nil {
+		msg := *m
+		ret.Messages = append(ret.Messages, &msg)
+	}
+
+	return ret, nil
+}
+
+func (c *MemoryMQ) UpdateMessageTimeout(ctx context.Context, msgID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.queue.update(msgID, time.Now())
+}
+
+func (c *MemoryMQ) DeleteMessage(ctx context.Context, msgID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.queue.delete(msgID)
+}
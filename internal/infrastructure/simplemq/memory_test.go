@@ -0,0 +1,218 @@
+package simplemq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	t0 := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return t0.Add(d) }
+
+	q := newQueue(30*time.Second, time.Hour)
+	q.send("a", "first", at(0))
+	q.send("b", "second", at(time.Second))
+
+	steps := []struct {
+		name string
+		now  time.Duration
+		op   func(now time.Time) (string, error)
+		want string
+		err  error
+	}{
+		{
+			name: "oldest message first",
+			now:  2 * time.Second,
+			op:   receive(q),
+			want: "a",
+		},
+		{
+			name: "acquired message is hidden",
+			now:  3 * time.Second,
+			op:   receive(q),
+			want: "b",
+		},
+		{
+			name: "nothing visible",
+			now:  4 * time.Second,
+			op:   receive(q),
+			want: "",
+		},
+		{
+			name: "extend a",
+			now:  20 * time.Second,
+			op:   func(now time.Time) (string, error) { return "", q.update("a", now) },
+		},
+		{
+			name: "b is redelivered after its visibility timeout",
+			now:  33 * time.Second,
+			op:   receive(q),
+			want: "b",
+		},
+		{
+			name: "a is still hidden by the extended timeout",
+			now:  40 * time.Second,
+			op:   receive(q),
+			want: "",
+		},
+		{
+			name: "a is redelivered after the extended timeout",
+			now:  50 * time.Second,
+			op:   receive(q),
+			want: "a",
+		},
+		{
+			name: "delete b",
+			op:   func(now time.Time) (string, error) { return "", q.delete("b") },
+		},
+		{
+			name: "delete unknown",
+			op:   func(now time.Time) (string, error) { return "", q.delete("b") },
+			err:  ErrNotFound,
+		},
+		{
+			name: "update unknown",
+			now:  time.Minute,
+			op:   func(now time.Time) (string, error) { return "", q.update("b", now) },
+			err:  ErrNotFound,
+		},
+		{
+			name: "a expires after the retention period",
+			now:  time.Hour,
+			op:   receive(q),
+			want: "",
+		},
+		{
+			name: "expired message cannot be extended",
+			now:  time.Hour,
+			op:   func(now time.Time) (string, error) { return "", q.update("a", now) },
+			err:  ErrNotFound,
+		},
+	}
+
+	for _, s := range steps {
+		got, err := s.op(at(s.now))
+		if !errors.Is(err, s.err) {
+			t.Fatalf("%s: error = %v, want %v", s.name, err, s.err)
+		}
+		if got != s.want {
+			t.Fatalf("%s: received %q, want %q", s.name, got, s.want)
+		}
+	}
+
+	if len(q.messages) != 0 {
+		t.Errorf("queue still holds %d messages", len(q.messages))
+	}
+}
+
+func receive(q *queue) func(now time.Time) (string, error) {
+	return func(now time.Time) (string, error) {
+		m := q.receive(now)
+		if m == nil {
+			return "", nil
+		}
+
+		if !m.AcquiredAt.Equal(now) || !m.VisibilityTimeoutAt.Equal(now.Add(q.visibilityTimeout)) {
+			return "", errors.New("visibility timeout was not set")
+		}
+
+		return m.ID, nil
+	}
+}
+
+// MemoryMQ と FileMQ に共通の振る舞い
+// 可視性タイムアウトは実時間で待つので短くする
+func testLocalMQ(t *testing.T, newMQ func(visibilityTimeout, retentionPeriod time.Duration) SimpleMQ) {
+	ctx := context.Background()
+	const visibilityTimeout = 200 * time.Millisecond
+
+	receiveOne := func(mq SimpleMQ) *Message {
+		t.Helper()
+
+		res, err := mq.ReceiveMessage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Messages) == 0 {
+			return nil
+		}
+
+		return res.Messages[0]
+	}
+
+	t.Run("redelivery", func(t *testing.T) {
+		mq := newMQ(visibilityTimeout, time.Hour)
+
+		sent, err := mq.SendMessage(ctx, &SendMessageRequest{Content: "hello"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := receiveOne(mq)
+		if m == nil || m.ID != sent.Message.ID || m.Content != "hello" {
+			t.Fatalf("ReceiveMessage() = %+v, want %s", m, sent.Message.ID)
+		}
+		if m := receiveOne(mq); m != nil {
+			t.Fatalf("ReceiveMessage() during the visibility timeout = %+v", m)
+		}
+
+		// 延長し続けている間は再配信されない
+		for i := 0; i < 3; i++ {
+			time.Sleep(visibilityTimeout / 2)
+			if err := mq.UpdateMessageTimeout(ctx, m.ID); err != nil {
+				t.Fatal(err)
+			}
+			if m := receiveOne(mq); m != nil {
+				t.Fatalf("ReceiveMessage() after UpdateMessageTimeout = %+v", m)
+			}
+		}
+
+		time.Sleep(visibilityTimeout + 50*time.Millisecond)
+		if m := receiveOne(mq); m == nil || m.ID != sent.Message.ID {
+			t.Fatalf("ReceiveMessage() after the visibility timeout = %+v, want %s", m, sent.Message.ID)
+		}
+
+		if err := mq.DeleteMessage(ctx, m.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := mq.DeleteMessage(ctx, m.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteMessage() of a deleted message error = %v, want ErrNotFound", err)
+		}
+		if err := mq.UpdateMessageTimeout(ctx, m.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("UpdateMessageTimeout() of a deleted message error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		mq := newMQ(visibilityTimeout, 100*time.Millisecond)
+
+		if _, err := mq.SendMessage(ctx, &SendMessageRequest{Content: "old"}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(150 * time.Millisecond)
+
+		if m := receiveOne(mq); m != nil {
+			t.Errorf("ReceiveMessage() of an expired message = %+v", m)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		mq := newMQ(visibilityTimeout, time.Hour)
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		if _, err := mq.SendMessage(canceled, &SendMessageRequest{Content: "x"}); !errors.Is(err, context.Canceled) {
+			t.Errorf("SendMessage() error = %v, want context.Canceled", err)
+		}
+		if _, err := mq.ReceiveMessage(canceled); !errors.Is(err, context.Canceled) {
+			t.Errorf("ReceiveMessage() error = %v, want context.Canceled", err)
+		}
+	})
+}
+
+func TestMemoryMQ(t *testing.T) {
+	testLocalMQ(t, NewMemoryMQ)
+}
@@ -7,9 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 )
 
+const (
+	DefaultBaseURL = "https://simplemq.tk1b.api.sacloud.jp"
+)
+
 var (
 	ErrNotFound = errors.New("not found")
 )
@@ -45,6 +50,34 @@ type Message struct {
 	VisibilityTimeoutAt time.Time `json:"visibility_timeout_at"`
 }
 
+func (m *Message) MarshalJSON() ([]byte, error) {
+	// 未設定の時刻は 0 として出力する
+	unixMilli := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+		return t.UnixMilli()
+	}
+
+	return json.Marshal(struct {
+		ID                  string `json:"id"`
+		Content             string `json:"content"`
+		CreatedAt           int64  `json:"created_at"`
+		UpdatedAt           int64  `json:"updated_at"`
+		ExpiresAt           int64  `json:"expires_at"`
+		AcquiredAt          int64  `json:"acquired_at"`
+		VisibilityTimeoutAt int64  `json:"visibility_timeout_at"`
+	}{
+		ID:                  m.ID,
+		Content:             m.Content,
+		CreatedAt:           unixMilli(m.CreatedAt),
+		UpdatedAt:           unixMilli(m.UpdatedAt),
+		ExpiresAt:           unixMilli(m.ExpiresAt),
+		AcquiredAt:          unixMilli(m.AcquiredAt),
+		VisibilityTimeoutAt: unixMilli(m.VisibilityTimeoutAt),
+	})
+}
+
 func (m *Message) UnmarshalJSON(b []byte) error {
 	msg := struct {
 		ID                  string `json:"id"`
@@ -72,13 +105,19 @@ func (m *Message) UnmarshalJSON(b []byte) error {
 }
 
 type SimpleMQClient struct {
+	baseURL    string
 	queueName  string
 	token      string
 	httpClient *http.Client
 }
 
 func NewSimpleMQClient(queueName, token string) SimpleMQ {
+	return NewSimpleMQClientWithBaseURL(DefaultBaseURL, queueName, token)
+}
+
+func NewSimpleMQClientWithBaseURL(baseURL, queueName, token string) SimpleMQ {
 	return &SimpleMQClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
 		queueName:  queueName,
 		token:      token,
 		httpClient: http.DefaultClient,
@@ -97,7 +136,7 @@ func (c *SimpleMQClient) SendMessage(ctx context.Context, msgReq *SendMessageReq
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
-		fmt.Sprintf("https://simplemq.tk1b.api.sacloud.jp/v1/queues/%s/messages", c.queueName),
+		fmt.Sprintf("%s/v1/queues/%s/messages", c.baseURL, c.queueName),
 		&b,
 	)
 	if err != nil {
@@ -126,7 +165,7 @@ func (c *SimpleMQClient) SendMessage(ctx context.Context, msgReq *SendMessageReq
 
 func (c *SimpleMQClient) ReceiveMessage(ctx context.Context) (*ReceiveMessageResponse, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
-		fmt.Sprintf("https://simplemq.tk1b.api.sacloud.jp/v1/queues/%s/messages", c.queueName),
+		fmt.Sprintf("%s/v1/queues/%s/messages", c.baseURL, c.queueName),
 		nil,
 	)
 	if err != nil {
@@ -142,7 +181,7 @@ func (c *SimpleMQClient) ReceiveMessage(ctx context.Context) (*ReceiveMessageRes
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return nil, errors.New("fatal")
+		return nil, errors.New(res.Status)
 	}
 
 	var ret ReceiveMessageResponse
@@ -155,7 +194,7 @@ func (c *SimpleMQClient) ReceiveMessage(ctx context.Context) (*ReceiveMessageRes
 
 func (c *SimpleMQClient) UpdateMessageTimeout(ctx context.Context, msgID string) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPut,
-		fmt.Sprintf("https://simplemq.tk1b.api.sacloud.jp/v1/queues/%s/messages/%s", c.queueName, msgID),
+		fmt.Sprintf("%s/v1/queues/%s/messages/%s", c.baseURL, c.queueName, msgID),
 		nil,
 	)
 	if err != nil {
@@ -175,7 +214,7 @@ func (c *SimpleMQClient) UpdateMessageTimeout(ctx context.Context, msgID string)
 			return ErrNotFound
 		}
 
-		return errors.New("fatal")
+		return errors.New(res.Status)
 	}
 
 	return nil
@@ -183,7 +222,7 @@ func (c *SimpleMQClient) UpdateMessageTimeout(ctx context.Context, msgID string)
 
 func (c *SimpleMQClient) DeleteMessage(ctx context.Context, msgID string) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodDelete,
-		fmt.Sprintf("https://simplemq.tk1b.api.sacloud.jp/v1/queues/%s/messages/%s", c.queueName, msgID),
+		fmt.Sprintf("%s/v1/queues/%s/messages/%s", c.baseURL, c.queueName, msgID),
 		nil,
 	)
 	if err != nil {
@@ -199,7 +238,12 @@ func (c *SimpleMQClient) DeleteMessage(ctx context.Context, msgID string) error
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return errors.New("fatal")
+		// 可視性タイムアウトの延長と同じく、存在しないメッセージは ErrNotFound にする
+		if res.StatusCode == http.StatusNotFound {
+			return ErrNotFound
+		}
+
+		return errors.New(res.Status)
 	}
 
 	return nil
@@ -0,0 +1,45 @@
+package simplemq
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+)
+
+// メッセージの受信に失敗した場合は指数バックオフで maxRetries 回まで再試行する
+func ReceiveMessageWithRetry(ctx context.Context, mqc SimpleMQ, maxRetries int, initialInterval time.Duration) (*ReceiveMessageResponse, error) {
+	interval := initialInterval
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		// メッセージ受信を試行
+		res, err := mqc.ReceiveMessage(ctx)
+		if err == nil {
+			return res, nil
+		}
+
+		// 最大試行回数に達したらエラーを返す
+		if attempt == maxRetries {
+			return nil, err
+		}
+
+		slog.Warn("Receive message failed, retrying", "attempt", attempt, "max_retries", maxRetries, "retry_in", interval, logging.Err(err))
+
+		// キャンセルされてたら中断
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// 待機（指数バックオフ）
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+
+	return nil, errors.New("unreachable code in ReceiveMessageWithRetry")
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// ログに付ける属性のキー
+// 同じものを指す属性はどのコマンドでも同じキーで出力し、まとめて検索できるようにする
+const (
+	KeyRunID    = "run_id"
+	KeyEventID  = "event_id"
+	KeyMsgID    = "msg_id"
+	KeyDeckCode = "deck_code"
+	KeyPlayerID = "player_id"
+	KeyStage    = "stage"
+	KeyCategory = "category"
+	KeyError    = "error"
+)
+
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, err
+	}
+
+	return level, nil
+}
+
+// format (json または text) と level (debug, info, warn, error) に従って w に出力するロガーを作る
+func New(w io.Writer, format string, level string) (*slog.Logger, error) {
+	lv, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{
+		Level: lv,
+	}
+
+	switch format {
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+// 標準エラー出力に出力するロガーをデフォルトにする
+// 標準出力は Mackerel のメトリクスの出力に使うため使わない
+func Setup(format string, level string) error {
+	logger, err := New(os.Stderr, format, level)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(logger)
+
+	return nil
+}
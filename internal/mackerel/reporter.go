@@ -0,0 +1,214 @@
+package mackerel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/metrics"
+)
+
+const (
+	DefaultBaseURL = "https://api.mackerelio.com"
+
+	SinkStdout = "stdout"
+	SinkFile   = "file"
+	SinkHTTP   = "http"
+)
+
+// Mackerel のサービスメトリック
+type Metric struct {
+	Name  string  `json:"name"`
+	Time  int64   `json:"time"`
+	Value float64 `json:"value"`
+}
+
+// サービスメトリックの送信先
+type Sink interface {
+	Send(ctx context.Context, service string, ms []*Metric) error
+}
+
+// mkr throw が読めるタブ区切りの形式で書き出す
+type writerSink struct {
+	w io.Writer
+}
+
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{
+		w: w,
+	}
+}
+
+func (s *writerSink) Send(ctx context.Context, service string, ms []*Metric) error {
+	var b strings.Builder
+	for _, m := range ms {
+		fmt.Fprintf(&b, "%s\t%s\t%d\n", m.Name, strconv.FormatFloat(m.Value, 'f', -1, 64), m.Time)
+	}
+
+	_, err := io.WriteString(s.w, b.String())
+
+	return err
+}
+
+// ファイルに mkr throw の形式で追記する
+type fileSink struct {
+	path string
+}
+
+func NewFileSink(path string) Sink {
+	return &fileSink{
+		path: path,
+	}
+}
+
+func (s *fileSink) Send(ctx context.Context, service string, ms []*Metric) error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := NewWriterSink(f).Send(ctx, service, ms); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Mackerel の API (POST /api/v0/services/{service}/tsdb) に送る
+type httpSink struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func NewHTTPSink(baseURL, apiKey string) Sink {
+	return &httpSink{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: http.DefaultClient,
+	}
+}
+
+func (s *httpSink) Send(ctx context.Context, service string, ms []*Metric) error {
+	body, err := json.Marshal(ms)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/api/v0/services/%s/tsdb", s.baseURL, service),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", s.apiKey)
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(b)))
+	}
+
+	return nil
+}
+
+// kind に対応する送信先を作る
+// kind が空の場合は nil を返す
+func NewSink(kind, file, baseURL, apiKey string) (Sink, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case SinkStdout:
+		return NewWriterSink(os.Stdout), nil
+	case SinkFile:
+		return NewFileSink(file), nil
+	case SinkHTTP:
+		return NewHTTPSink(baseURL, apiKey), nil
+	default:
+		return nil, fmt.Errorf("unknown sink %q", kind)
+	}
+}
+
+// メトリクス名に使えない文字を _ に置き換える
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// 集計値を {prefix}.{name}.{label values} のサービスメトリックに変換する
+// _total と _seconds の接尾辞は付けない
+func FromSamples(prefix string, samples []*metrics.Sample, t time.Time) []*Metric {
+	ms := make([]*Metric, 0, len(samples))
+	for _, s := range samples {
+		name := s.Name
+		// systemd のユニットから送っていた名前を引き継ぐ
+		if name == "last_run_timestamp_seconds" {
+			name = "last_run_time"
+		}
+		name = strings.TrimSuffix(name, "_total")
+		name = strings.Replace(name, "_seconds", "", 1)
+
+		parts := []string{prefix, sanitize(name)}
+		for _, v := range s.LabelValues {
+			parts = append(parts, sanitize(v))
+		}
+
+		ms = append(ms, &Metric{
+			Name:  strings.Join(parts, "."),
+			Time:  t.Unix(),
+			Value: s.Value,
+		})
+	}
+
+	return ms
+}
+
+// 実行の集計値をサービスメトリックとして送る
+// 送信先が nil の場合は何もしない
+type Reporter struct {
+	sink    Sink
+	service string
+	prefix  string
+}
+
+func NewReporter(sink Sink, service, prefix string) *Reporter {
+	return &Reporter{
+		sink:    sink,
+		service: service,
+		prefix:  prefix,
+	}
+}
+
+func (r *Reporter) Report(ctx context.Context, m *metrics.Metrics) error {
+	if r.sink == nil {
+		return nil
+	}
+
+	samples, err := m.Samples()
+	if err != nil {
+		return err
+	}
+
+	return r.sink.Send(ctx, r.service, FromSamples(r.prefix, samples, time.Now()))
+}
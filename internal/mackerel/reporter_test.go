@@ -0,0 +1,230 @@
+package mackerel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/metrics"
+)
+
+func TestFromSamples(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name   string
+		sample metrics.Sample
+		want   string
+	}{
+		{
+			name:   "counter",
+			sample: metrics.Sample{Name: "events_enqueued_total", Value: 3},
+			want:   "job.events_enqueued",
+		},
+		{
+			name:   "label values",
+			sample: metrics.Sample{Name: "results_total", LabelValues: []string{"inserted"}, Value: 3},
+			want:   "job.results.inserted",
+		},
+		{
+			name:   "seconds suffix",
+			sample: metrics.Sample{Name: "run_duration_seconds", Value: 3},
+			want:   "job.run_duration",
+		},
+		{
+			name:   "histogram sum",
+			sample: metrics.Sample{Name: "stage_duration_seconds_sum", LabelValues: []string{"fetch"}, Value: 3},
+			want:   "job.stage_duration_sum.fetch",
+		},
+		{
+			name:   "last run time",
+			sample: metrics.Sample{Name: "last_run_timestamp_seconds", Value: 3},
+			want:   "job.last_run_time",
+		},
+		{
+			name:   "sanitized label value",
+			sample: metrics.Sample{Name: "errors_total", LabelValues: []string{"dead letter.x/y"}, Value: 3},
+			want:   "job.errors.dead_letter_x_y",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := FromSamples("job", []*metrics.Sample{&tt.sample}, now)
+			if len(ms) != 1 {
+				t.Fatalf("FromSamples() = %d metrics, want 1", len(ms))
+			}
+
+			want := Metric{Name: tt.want, Time: now.Unix(), Value: tt.sample.Value}
+			if *ms[0] != want {
+				t.Errorf("FromSamples() = %+v, want %+v", *ms[0], want)
+			}
+		})
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ms := []*Metric{
+		{Name: "job.events_enqueued", Time: 1700000000, Value: 3},
+		{Name: "job.run_duration", Time: 1700000000, Value: 1.5},
+	}
+
+	if err := NewWriterSink(buf).Send(context.Background(), "service", ms); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	want := "job.events_enqueued\t3\t1700000000\njob.run_duration\t1.5\t1700000000\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Send() wrote %q, want %q", got, want)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mackerel.tsv")
+	sink := NewFileSink(path)
+
+	for i := 0; i < 2; i++ {
+		if err := sink.Send(context.Background(), "service", []*Metric{{Name: "job.x", Time: 1, Value: float64(i)}}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "job.x\t0\t1\njob.x\t1\t1\n"
+	if got := string(b); got != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "error", status: http.StatusForbidden, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []*Metric
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/api/v0/services/monolith/tsdb" {
+					t.Errorf("request = %s %s", r.Method, r.URL.Path)
+				}
+				if key := r.Header.Get("X-Api-Key"); key != "secret" {
+					t.Errorf("X-Api-Key = %q, want secret", key)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("failed to decode body: %v", err)
+				}
+
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			ms := []*Metric{{Name: "job.x", Time: 1, Value: 2}}
+			err := NewHTTPSink(srv.URL+"/", "secret").Send(context.Background(), "monolith", ms)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(got) != 1 || *got[0] != *ms[0] {
+				t.Errorf("server received %v, want %v", got, ms)
+			}
+		})
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	tests := []struct {
+		kind    string
+		wantNil bool
+		wantErr bool
+	}{
+		{kind: "", wantNil: true},
+		{kind: SinkStdout},
+		{kind: SinkFile},
+		{kind: SinkHTTP},
+		{kind: "syslog", wantNil: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		sink, err := NewSink(tt.kind, "mackerel.tsv", DefaultBaseURL, "secret")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewSink(%q) error = %v, wantErr %v", tt.kind, err, tt.wantErr)
+		}
+		if (sink == nil) != tt.wantNil {
+			t.Errorf("NewSink(%q) = %v, wantNil %v", tt.kind, sink, tt.wantNil)
+		}
+	}
+}
+
+type recordingSink struct {
+	service string
+	ms      []*Metric
+}
+
+func (s *recordingSink) Send(ctx context.Context, service string, ms []*Metric) error {
+	s.service = service
+	s.ms = ms
+	return nil
+}
+
+func TestReporterReport(t *testing.T) {
+	tests := []struct {
+		name          string
+		succeeded     bool
+		wantLastRun   bool
+		wantRunFailed float64
+	}{
+		{name: "succeeded", succeeded: true, wantLastRun: true, wantRunFailed: 0},
+		{name: "failed", succeeded: false, wantLastRun: false, wantRunFailed: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := metrics.New("dequeue")
+			m.Finish(tt.succeeded)
+
+			sink := &recordingSink{}
+			if err := NewReporter(sink, "monolith", "job.dequeue").Report(context.Background(), m); err != nil {
+				t.Fatalf("Report() error = %v", err)
+			}
+
+			if sink.service != "monolith" {
+				t.Errorf("service = %q, want monolith", sink.service)
+			}
+
+			values := map[string]float64{}
+			for _, metric := range sink.ms {
+				values[metric.Name] = metric.Value
+			}
+
+			if _, ok := values["job.dequeue.last_run_time"]; ok != tt.wantLastRun {
+				t.Errorf("last_run_time sent = %v, want %v", ok, tt.wantLastRun)
+			}
+			if got, ok := values["job.dequeue.run_failed"]; !ok || got != tt.wantRunFailed {
+				t.Errorf("run_failed = %v (sent %v), want %v", got, ok, tt.wantRunFailed)
+			}
+		})
+	}
+}
+
+func TestReporterNilSink(t *testing.T) {
+	if err := NewReporter(nil, "monolith", "job").Report(context.Background(), metrics.New("enqueue")); err != nil {
+		t.Errorf("Report() error = %v, want nil", err)
+	}
+}
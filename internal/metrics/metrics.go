@@ -0,0 +1,332 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	namespace = "cityleague_import"
+
+	// Pushgateway の job ラベル
+	pushJob = "import-cityleague-result-job"
+
+	lastRunName = namespace + "_last_run_timestamp_seconds"
+)
+
+// 取り込みの処理段階 (stage ラベル)
+const (
+	StageGetEvents     = "get_events"
+	StageReceive       = "receive"
+	StageEvent         = "event"
+	StageEventResults  = "event_results"
+	StageDeckRecipe    = "deck_recipe"
+	StageImport        = "import"
+	StageEnqueueImages = "enqueue_images"
+	StageUploadImages  = "upload_images"
+)
+
+// エラーの分類 (category ラベル)
+const (
+	CategoryGetEvents     = "get_events"
+	CategoryEnqueue       = "enqueue"
+	CategoryReceive       = "receive"
+	CategoryDecode        = "decode"
+	CategoryEventResults  = "event_results"
+	CategorySchedule      = "schedule"
+	CategoryDeckRecipe    = "deck_recipe"
+	CategoryClassify      = "classify"
+	CategoryImport        = "import"
+	CategoryEnqueueImages = "enqueue_images"
+	CategoryUploadImages  = "upload_images"
+	CategoryDelete        = "delete"
+	CategoryDeadLetter    = "dead_letter"
+	CategoryPanic         = "panic"
+)
+
+// 成績の書き込み結果 (outcome ラベル)
+const (
+	OutcomeInserted  = "inserted"
+	OutcomeUpdated   = "updated"
+	OutcomeUnchanged = "unchanged"
+	OutcomeDeleted   = "deleted"
+)
+
+// 各コマンドの1回の実行で集計するメトリクス
+// 実行の終わりに Export で node_exporter の textfile に書き出すか Pushgateway に送る
+type Metrics struct {
+	command string
+
+	// Pushgateway 向け (command はグルーピングキーで付ける)
+	registry *prometheus.Registry
+	// textfile 向け (command ラベルを付ける)
+	labeled *prometheus.Registry
+	// labeled に command ラベルを付けて登録する
+	labeledRegisterer prometheus.Registerer
+
+	EventsEnqueued   prometheus.Counter
+	MessagesReceived prometheus.Counter
+	Results          *prometheus.CounterVec
+	ImagesUploaded   prometheus.Counter
+	Errors           *prometheus.CounterVec
+	StageDuration    *prometheus.HistogramVec
+
+	lastRun     prometheus.Gauge
+	runFailed   prometheus.Gauge
+	runDuration prometheus.Gauge
+	startedAt   time.Time
+	finishOnce  sync.Once
+	succeeded   bool
+}
+
+// 集計値を1つずつ取り出したもの
+// ヒストグラムは Name に _sum と _count を付けた2つになる
+type Sample struct {
+	// 名前空間を除いたメトリクス名 (results_total など)
+	Name string
+	// ラベル名の順に並べたラベルの値
+	LabelValues []string
+	Value       float64
+}
+
+func New(command string) *Metrics {
+	m := &Metrics{
+		command:  command,
+		registry: prometheus.NewRegistry(),
+		labeled:  prometheus.NewRegistry(),
+
+		EventsEnqueued: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_enqueued_total",
+			Help:      "Number of official events sent to the import queue.",
+		}),
+		MessagesReceived: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_received_total",
+			Help:      "Number of messages received from the queue.",
+		}),
+		Results: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "results_total",
+			Help:      "Number of cityleague result rows written, by outcome.",
+		}, []string{"outcome"}),
+		ImagesUploaded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "images_uploaded_total",
+			Help:      "Number of deck image renditions uploaded.",
+		}),
+		Errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Number of errors, by category.",
+		}, []string{"category"}),
+		StageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "stage_duration_seconds",
+			Help:      "Time spent in each stage of the import.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		}, []string{"stage"}),
+
+		lastRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_run_timestamp_seconds",
+			Help:      "Unix time the last successful run finished. Failed runs keep the previous value.",
+		}),
+		runFailed: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "run_failed",
+			Help:      "1 if the run failed, 0 otherwise.",
+		}),
+		runDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "run_duration_seconds",
+			Help:      "Duration of the run.",
+		}),
+		startedAt: time.Now(),
+	}
+
+	collectors := []prometheus.Collector{
+		m.EventsEnqueued,
+		m.MessagesReceived,
+		m.Results,
+		m.ImagesUploaded,
+		m.Errors,
+		m.StageDuration,
+		m.lastRun,
+		m.runFailed,
+		m.runDuration,
+	}
+
+	m.labeledRegisterer = prometheus.WrapRegistererWith(prometheus.Labels{"command": command}, m.labeled)
+	m.registry.MustRegister(collectors...)
+	m.labeledRegisterer.MustRegister(collectors...)
+
+	return m
+}
+
+// stage の所要時間を記録する関数を返す
+//
+//	defer m.Time(metrics.StageImport)()
+func (m *Metrics) Time(stage string) func() {
+	start := time.Now()
+
+	return func() {
+		m.StageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (m *Metrics) Error(category string) {
+	m.Errors.WithLabelValues(category).Inc()
+}
+
+// 実行の成否と所要時間を記録する
+// 最終実行時刻は正常終了したときだけ更新し、失敗した実行で監視の最終実行時刻が進まないようにする
+// 何度呼んでも最初の呼び出し時の値になる
+// Export や Samples の前に呼ばなかった場合は失敗として扱う
+func (m *Metrics) Finish(succeeded bool) {
+	m.finishOnce.Do(func() {
+		now := time.Now()
+		m.runDuration.Set(now.Sub(m.startedAt).Seconds())
+		m.succeeded = succeeded
+
+		if succeeded {
+			m.lastRun.Set(float64(now.Unix()))
+			m.runFailed.Set(0)
+			return
+		}
+
+		m.runFailed.Set(1)
+	})
+}
+
+// 失敗した実行では最終実行時刻を出力しない
+func (m *Metrics) gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	if m.succeeded {
+		return g
+	}
+
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		if err != nil {
+			return nil, err
+		}
+
+		filtered := make([]*dto.MetricFamily, 0, len(mfs))
+		for _, mf := range mfs {
+			if mf.GetName() != lastRunName {
+				filtered = append(filtered, mf)
+			}
+		}
+
+		return filtered, nil
+	})
+}
+
+// 前回書き出した textfile から最終実行時刻を読み出す
+// ファイルがない場合や読み取れない場合は nil を返し、次の正常終了まで出力しない
+func previousLastRun(path string) *dto.MetricFamily {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	mfs, err := parser.TextToMetricFamilies(f)
+	if err != nil {
+		return nil
+	}
+
+	return mfs[lastRunName]
+}
+
+// 集計値をすべて取り出す
+func (m *Metrics) Samples() ([]*Sample, error) {
+	m.Finish(false)
+
+	mfs, err := m.gatherer(m.registry).Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []*Sample
+	for _, mf := range mfs {
+		name := strings.TrimPrefix(mf.GetName(), namespace+"_")
+		for _, metric := range mf.GetMetric() {
+			var values []string
+			for _, lp := range metric.GetLabel() {
+				values = append(values, lp.GetValue())
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				samples = append(samples, &Sample{Name: name, LabelValues: values, Value: metric.GetCounter().GetValue()})
+			case dto.MetricType_GAUGE:
+				samples = append(samples, &Sample{Name: name, LabelValues: values, Value: metric.GetGauge().GetValue()})
+			case dto.MetricType_HISTOGRAM:
+				h := metric.GetHistogram()
+				samples = append(samples,
+					&Sample{Name: name + "_sum", LabelValues: values, Value: h.GetSampleSum()},
+					&Sample{Name: name + "_count", LabelValues: values, Value: float64(h.GetSampleCount())},
+				)
+			}
+		}
+	}
+
+	return samples, nil
+}
+
+// textfileDir が指定されていれば node_exporter の textfile collector 向けのファイルを書き出し、
+// pushURL が指定されていれば Pushgateway に送る
+// どちらも Prometheus のテキスト形式で、OpenMetrics 形式ではない (textfile collector が読めるのはテキスト形式だけ)
+// 失敗した実行では前回の最終実行時刻を残す
+func (m *Metrics) Export(ctx context.Context, textfileDir string, pushURL string) error {
+	m.Finish(false)
+
+	if textfileDir != "" {
+		path := filepath.Join(textfileDir, fmt.Sprintf("import_cityleague_result_job_%s.prom", m.command))
+
+		g := m.gatherer(m.labeled)
+		if !m.succeeded {
+			if prev := previousLastRun(path); prev != nil {
+				g = prometheus.Gatherers{g, prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+					return []*dto.MetricFamily{prev}, nil
+				})}
+			}
+		}
+
+		if err := prometheus.WriteToTextfile(path, g); err != nil {
+			return fmt.Errorf("failed to write metrics to %s: %w", path, err)
+		}
+	}
+
+	if pushURL != "" {
+		pusher := push.New(pushURL, pushJob).
+			Grouping("command", m.command).
+			Gatherer(m.gatherer(m.registry))
+
+		// PUT はグループのメトリクスをすべて置き換えるので、失敗した実行は POST で送って前回の最終実行時刻を残す
+		var err error
+		if m.succeeded {
+			err = pusher.PushContext(ctx)
+		} else {
+			err = pusher.AddContext(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to push metrics to %s: %w", pushURL, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func readTextfile(t *testing.T, dir string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join(dir, "import_cityleague_result_job_dequeue.prom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+// 出力から指定したメトリクスの行を返す
+func sampleLine(text string, name string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, name+"{") || strings.HasPrefix(line, name+" ") {
+			return line
+		}
+	}
+
+	return ""
+}
+
+func TestExportTextfile(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// 前回の記録がないまま失敗した場合は最終実行時刻を出力しない
+	m := New("dequeue")
+	m.Finish(false)
+	if err := m.Export(ctx, dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	text := readTextfile(t, dir)
+	if line := sampleLine(text, lastRunName); line != "" {
+		t.Errorf("failed run without a previous success wrote %q", line)
+	}
+	if line := sampleLine(text, namespace+"_run_failed"); !strings.HasSuffix(line, " 1") {
+		t.Errorf("run_failed = %q, want 1", line)
+	}
+
+	m = New("dequeue")
+	m.MessagesReceived.Add(3)
+	m.Finish(true)
+	if err := m.Export(ctx, dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	succeeded := sampleLine(readTextfile(t, dir), lastRunName)
+	if succeeded == "" || !strings.Contains(succeeded, `command="dequeue"`) {
+		t.Fatalf("last run after success = %q, want a sample with the command label", succeeded)
+	}
+
+	// 失敗した実行は前回の最終実行時刻を残し、他のメトリクスは書き換える
+	m = New("dequeue")
+	m.MessagesReceived.Add(5)
+	m.Finish(false)
+	if err := m.Export(ctx, dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	text = readTextfile(t, dir)
+	if line := sampleLine(text, lastRunName); line != succeeded {
+		t.Errorf("last run after failure = %q, want %q", line, succeeded)
+	}
+	if line := sampleLine(text, namespace+"_messages_received_total"); !strings.HasSuffix(line, " 5") {
+		t.Errorf("messages_received_total = %q, want 5", line)
+	}
+	if line := sampleLine(text, namespace+"_run_failed"); !strings.HasSuffix(line, " 1") {
+		t.Errorf("run_failed = %q, want 1", line)
+	}
+}
+
+func TestExportPush(t *testing.T) {
+	type request struct {
+		method string
+		path   string
+		body   string
+	}
+
+	var mu sync.Mutex
+	var requests []request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		requests = append(requests, request{method: r.Method, path: r.URL.Path, body: string(b)})
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+
+	m := New("dequeue")
+	m.Finish(true)
+	if err := m.Export(ctx, "", ts.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	m = New("dequeue")
+	m.Finish(false)
+	if err := m.Export(ctx, "", ts.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(requests))
+	}
+
+	// 正常終了はグループを置き換え、失敗は前回の最終実行時刻を残すために追加で送る
+	cases := []struct {
+		method      string
+		wantLastRun bool
+	}{
+		{http.MethodPut, true},
+		{http.MethodPost, false},
+	}
+	for i, tc := range cases {
+		r := requests[i]
+		if r.method != tc.method {
+			t.Errorf("requests[%d].method = %s, want %s", i, r.method, tc.method)
+		}
+		if r.path != "/metrics/job/"+pushJob+"/command/dequeue" {
+			t.Errorf("requests[%d].path = %s", i, r.path)
+		}
+		if got := strings.Contains(r.body, lastRunName); got != tc.wantLastRun {
+			t.Errorf("requests[%d] contains %s = %v, want %v", i, lastRunName, got, tc.wantLastRun)
+		}
+	}
+}
+
+func TestSamples(t *testing.T) {
+	names := func(m *Metrics) map[string]float64 {
+		samples, err := m.Samples()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values := map[string]float64{}
+		for _, s := range samples {
+			if len(s.LabelValues) == 0 {
+				values[s.Name] = s.Value
+			}
+		}
+		return values
+	}
+
+	m := New("dequeue")
+	m.Finish(true)
+	if values := names(m); values["last_run_timestamp_seconds"] == 0 || values["run_failed"] != 0 {
+		t.Errorf("samples of a successful run = %v", values)
+	}
+
+	// Finish を呼ばなかった場合は失敗として扱う
+	m = New("dequeue")
+	values := names(m)
+	if _, ok := values["last_run_timestamp_seconds"]; ok {
+		t.Errorf("samples of a failed run contain last_run_timestamp_seconds: %v", values)
+	}
+	if values["run_failed"] != 1 {
+		t.Errorf("run_failed = %v, want 1", values["run_failed"])
+	}
+}
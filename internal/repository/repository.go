@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+)
+
+// 主キー (CityleagueScheduleId, OfficialEventId, PlayerId) が重複したときの扱い
+type ConflictPolicy int
+
+const (
+	// 順位・ポイント・プレイヤー名・デッキコードが変わっていれば更新する
+	// アーキタイプは空でない値に変わった場合のみ更新する
+	ConflictUpdate ConflictPolicy = iota
+	// 既存の行をそのまま残す
+	ConflictIgnore
+)
+
+// ReplaceEvent で書き込んだ行数
+type ReplaceStats struct {
+	Inserted int
+	Updated  int
+	// 変更がなかったため書き込まなかった行
+	Unchanged int
+	Deleted   int
+}
+
+type ScheduleRepository interface {
+	FindAll(ctx context.Context) ([]*model.CityleagueSchedule, error)
+	// date を期間に含むシティーリーグの開催期間を返す
+	// 該当する期間がない場合は ErrNotFound を返す
+	FindByDate(ctx context.Context, date time.Time) (*model.CityleagueSchedule, error)
+}
+
+type ResultRepository interface {
+	FindByOfficialEventId(ctx context.Context, officialEventId uint) ([]*model.CityleagueResult, error)
+	// 成績をまとめて登録する
+	Upsert(ctx context.Context, results []*model.CityleagueResult, policy ConflictPolicy) error
+	// イベントの成績を丸ごと置き換え、追加・更新・削除した行数を返す
+	ReplaceEvent(ctx context.Context, officialEventId uint, results []*model.CityleagueResult) (*ReplaceStats, error)
+	// デッキコードが登録されている成績のデッキコードを重複なく返す
+	FindDeckCodes(ctx context.Context) ([]string, error)
+	// デッキコードが一致する成績のアーキタイプを更新し、更新した件数を返す
+	UpdateArchetype(ctx context.Context, deckCode string, archetypeId string) (int64, error)
+}
+
+type PendingEventRepository interface {
+	FindAll(ctx context.Context) ([]*model.PendingEvent, error)
+	// 同じイベントが保留済みの場合は内容を上書きする
+	Save(ctx context.Context, pe *model.PendingEvent) error
+	Delete(ctx context.Context, officialEventId uint) error
+}
+
+type DeckRepository interface {
+	Exists(ctx context.Context, code string) (bool, error)
+	FindCards(ctx context.Context, code string) ([]*model.DeckCard, error)
+	// デッキとカードの構成を保存する
+	// 保存済みの場合はカードの構成を置き換える
+	Save(ctx context.Context, deck *model.Deck, cards []*model.DeckCard) error
+}
+
+type DeckImageRepository interface {
+	// key の画像の記録を返す
+	// 記録がない場合は ErrNotFound を返す
+	FindByKey(ctx context.Context, key string) (*model.DeckImage, error)
+	FindAll(ctx context.Context) ([]*model.DeckImage, error)
+	// 記録済みの場合は上書きする
+	Save(ctx context.Context, img *model.DeckImage) error
+	MarkVerified(ctx context.Context, key string, verifiedAt time.Time) error
+}
+
+type ImportRunRepository interface {
+	// 実行の記録を追加し、採番した ID を run.ID に設定する
+	Create(ctx context.Context, run *model.ImportRun) error
+	// 記録済みの実行を上書きする
+	Save(ctx context.Context, run *model.ImportRun) error
+	// 記録がない場合は ErrNotFound を返す
+	FindById(ctx context.Context, id uint) (*model.ImportRun, error)
+	// 開始日時の新しい順に最大 limit 件 (0 の場合はすべて) 返す
+	// command が空の場合はすべてのコマンドの実行を返す
+	FindRecent(ctx context.Context, command string, limit int) ([]*model.ImportRun, error)
+}
+
+// 同じ主キーの行が複数ある場合は先に出現した行を採用する
+func UniqueResults(results []*model.CityleagueResult) []*model.CityleagueResult {
+	type key struct {
+		cityleagueScheduleId string
+		officialEventId      uint
+		playerId             string
+	}
+
+	seen := make(map[key]struct{}, len(results))
+	rows := make([]*model.CityleagueResult, 0, len(results))
+	for _, r := range results {
+		k := key{r.CityleagueScheduleId, r.OfficialEventId, r.PlayerId}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		rows = append(rows, r)
+	}
+
+	return rows
+}
+
+// イベントの既存の成績 existing を results で置き換えたときの行数を求める
+// 更新の判定は ConflictUpdate と同じ
+func DiffResults(existing []*model.CityleagueResult, results []*model.CityleagueResult) *ReplaceStats {
+	type key struct {
+		cityleagueScheduleId string
+		playerId             string
+	}
+
+	current := make(map[key]*model.CityleagueResult, len(existing))
+	for _, r := range existing {
+		current[key{r.CityleagueScheduleId, r.PlayerId}] = r
+	}
+
+	stats := &ReplaceStats{}
+	rows := UniqueResults(results)
+	for _, r := range rows {
+		k := key{r.CityleagueScheduleId, r.PlayerId}
+		c, ok := current[k]
+		if !ok {
+			stats.Inserted++
+			continue
+		}
+		delete(current, k)
+
+		if c.Rank != r.Rank || c.Point != r.Point || c.PlayerName != r.PlayerName || c.DeckCode != r.DeckCode ||
+			(r.ArchetypeId != "" && r.ArchetypeId != c.ArchetypeId) {
+			stats.Updated++
+		} else {
+			stats.Unchanged++
+		}
+	}
+	stats.Deleted = len(current)
+
+	return stats
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+)
+
+func result(scheduleId, playerId string, rank uint, deckCode, archetypeId string) *model.CityleagueResult {
+	return &model.CityleagueResult{
+		CityleagueScheduleId: scheduleId,
+		OfficialEventId:      1,
+		PlayerId:             playerId,
+		PlayerName:           "player " + playerId,
+		Rank:                 rank,
+		Point:                10,
+		DeckCode:             deckCode,
+		ArchetypeId:          archetypeId,
+	}
+}
+
+func TestUniqueResults(t *testing.T) {
+	first := result("s1", "p1", 1, "", "")
+	dup := result("s1", "p1", 2, "", "")
+	other := result("s2", "p1", 3, "", "")
+
+	rows := UniqueResults([]*model.CityleagueResult{first, dup, other})
+	if len(rows) != 2 || rows[0] != first || rows[1] != other {
+		t.Errorf("UniqueResults() = %v, want the first row of each key in order", rows)
+	}
+}
+
+func TestDiffResults(t *testing.T) {
+	existing := []*model.CityleagueResult{
+		result("s1", "p1", 1, "AAA", "arch-a"),
+		result("s1", "p2", 2, "BBB", "arch-b"),
+		result("s1", "p3", 3, "CCC", ""),
+	}
+
+	tests := []struct {
+		name    string
+		results []*model.CityleagueResult
+		want    ReplaceStats
+	}{
+		{
+			name:    "same rows",
+			results: []*model.CityleagueResult{result("s1", "p1", 1, "AAA", "arch-a"), result("s1", "p2", 2, "BBB", "arch-b"), result("s1", "p3", 3, "CCC", "")},
+			want:    ReplaceStats{Unchanged: 3},
+		},
+		{
+			name:    "empty archetype keeps the existing one",
+			results: []*model.CityleagueResult{result("s1", "p1", 1, "AAA", ""), result("s1", "p2", 2, "BBB", ""), result("s1", "p3", 3, "CCC", "")},
+			want:    ReplaceStats{Unchanged: 3},
+		},
+		{
+			name:    "changed rank and new archetype",
+			results: []*model.CityleagueResult{result("s1", "p1", 2, "AAA", "arch-a"), result("s1", "p2", 2, "BBB", "arch-b"), result("s1", "p3", 3, "CCC", "arch-c")},
+			want:    ReplaceStats{Updated: 2, Unchanged: 1},
+		},
+		{
+			name:    "inserted and deleted",
+			results: []*model.CityleagueResult{result("s1", "p1", 1, "AAA", "arch-a"), result("s1", "p4", 4, "DDD", "")},
+			want:    ReplaceStats{Inserted: 1, Unchanged: 1, Deleted: 2},
+		},
+		{
+			name:    "duplicate rows are counted once",
+			results: []*model.CityleagueResult{result("s1", "p4", 4, "DDD", ""), result("s1", "p4", 5, "DDD", "")},
+			want:    ReplaceStats{Inserted: 1, Deleted: 3},
+		},
+		{
+			name:    "another schedule is a different row",
+			results: []*model.CityleagueResult{result("s2", "p1", 1, "AAA", "arch-a")},
+			want:    ReplaceStats{Inserted: 1, Deleted: 3},
+		},
+		{
+			name: "no results",
+			want: ReplaceStats{Deleted: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffResults(existing, tt.results)
+			if *got != tt.want {
+				t.Errorf("DiffResults() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+)
+
+// どの開催期間にも含まれない日付
+// errors.Is(err, ErrNotFound) でも判定できる
+type ScheduleNotFoundError struct {
+	Date time.Time
+}
+
+func (e *ScheduleNotFoundError) Error() string {
+	return fmt.Sprintf("no cityleague schedule covers %s", e.Date.Format(time.DateOnly))
+}
+
+func (e *ScheduleNotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// 複数の開催期間に含まれる日付
+type OverlappingSchedulesError struct {
+	Date      time.Time
+	Schedules []*model.CityleagueSchedule
+}
+
+func (e *OverlappingSchedulesError) Error() string {
+	ids := make([]string, 0, len(e.Schedules))
+	for _, cs := range e.Schedules {
+		ids = append(ids, cs.ID)
+	}
+
+	return fmt.Sprintf("%s is covered by overlapping cityleague schedules: %s", e.Date.Format(time.DateOnly), strings.Join(ids, ", "))
+}
+
+// 開催期間を開始日順に並べた区間インデックス
+// 実行中に1度だけ読み込み、イベントごとの問い合わせをメモリ上で済ませる
+type CachedScheduleRepository struct {
+	schedules []*model.CityleagueSchedule
+	// schedules[:i+1] の中で最も遅い終了日
+	maxToDates []time.Time
+}
+
+func NewCachedScheduleRepository(ctx context.Context, src ScheduleRepository) (ScheduleRepository, error) {
+	schedules, err := src.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]*model.CityleagueSchedule, len(schedules))
+	copy(sorted, schedules)
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].FromDate.Equal(sorted[j].FromDate) {
+			return sorted[i].FromDate.Before(sorted[j].FromDate)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	maxToDates := make([]time.Time, len(sorted))
+	for i, cs := range sorted {
+		maxToDates[i] = cs.ToDate
+		if i > 0 && maxToDates[i-1].After(cs.ToDate) {
+			maxToDates[i] = maxToDates[i-1]
+		}
+	}
+
+	return &CachedScheduleRepository{
+		schedules:  sorted,
+		maxToDates: maxToDates,
+	}, nil
+}
+
+func (r *CachedScheduleRepository) FindAll(ctx context.Context) ([]*model.CityleagueSchedule, error) {
+	schedules := make([]*model.CityleagueSchedule, len(r.schedules))
+	copy(schedules, r.schedules)
+
+	return schedules, nil
+}
+
+func (r *CachedScheduleRepository) FindByDate(ctx context.Context, date time.Time) (*model.CityleagueSchedule, error) {
+	// 開始日が date 以前の開催期間のうち最後のもの
+	i := sort.Search(len(r.schedules), func(i int) bool {
+		return r.schedules[i].FromDate.After(date)
+	}) - 1
+
+	var matched []*model.CityleagueSchedule
+	for ; i >= 0 && !r.maxToDates[i].Before(date); i-- {
+		if !r.schedules[i].ToDate.Before(date) {
+			matched = append(matched, r.schedules[i])
+		}
+	}
+
+	switch len(matched) {
+	case 0:
+		return nil, &ScheduleNotFoundError{Date: date}
+	case 1:
+		return matched[0], nil
+	default:
+		sort.Slice(matched, func(i, j int) bool {
+			return matched[i].ID < matched[j].ID
+		})
+		return nil, &OverlappingSchedulesError{Date: date, Schedules: matched}
+	}
+}
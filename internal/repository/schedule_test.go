@@ -0,0 +1,98 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/memory"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/model"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+func TestCachedScheduleRepositoryFindByDate(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	// 登録順は開始日順ではない
+	base := memory.NewScheduleRepository(
+		&model.CityleagueSchedule{ID: "s3", FromDate: day("2025-12-01"), ToDate: day("2025-12-31")},
+		&model.CityleagueSchedule{ID: "s1", FromDate: day("2025-10-01"), ToDate: day("2025-10-31")},
+		&model.CityleagueSchedule{ID: "s2", FromDate: day("2025-11-01"), ToDate: day("2025-11-30")},
+		// s2 の期間内に重なっている
+		&model.CityleagueSchedule{ID: "s2-extra", FromDate: day("2025-11-20"), ToDate: day("2025-11-25")},
+		// 長い期間の途中で始まって先に終わる期間
+		&model.CityleagueSchedule{ID: "long", FromDate: day("2026-01-01"), ToDate: day("2026-03-31")},
+		&model.CityleagueSchedule{ID: "short", FromDate: day("2026-02-01"), ToDate: day("2026-02-05")},
+	)
+
+	repo, err := repository.NewCachedScheduleRepository(context.Background(), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		date string
+		// 空の場合は該当なし
+		want string
+		// 重なっている期間の ID (開始日順)
+		overlap []string
+	}{
+		{date: "2025-10-01", want: "s1"},
+		{date: "2025-10-31", want: "s1"},
+		{date: "2025-12-15", want: "s3"},
+		{date: "2025-09-30"},
+		{date: "2026-04-01"},
+		{date: "2025-11-22", overlap: []string{"s2", "s2-extra"}},
+		{date: "2025-11-26", want: "s2"},
+		{date: "2026-02-10", want: "long"},
+		{date: "2026-02-03", overlap: []string{"long", "short"}},
+	}
+
+	for _, tt := range tests {
+		cs, err := repo.FindByDate(context.Background(), day(tt.date))
+
+		var oe *repository.OverlappingSchedulesError
+		if errors.As(err, &oe) {
+			var ids []string
+			for _, s := range oe.Schedules {
+				ids = append(ids, s.ID)
+			}
+			if len(ids) != len(tt.overlap) || (len(ids) == 2 && (ids[0] != tt.overlap[0] || ids[1] != tt.overlap[1])) {
+				t.Errorf("FindByDate(%s) overlapping = %v, want %v", tt.date, ids, tt.overlap)
+			}
+			continue
+		}
+		if tt.overlap != nil {
+			t.Errorf("FindByDate(%s) error = %v, want overlapping %v", tt.date, err, tt.overlap)
+			continue
+		}
+
+		if tt.want == "" {
+			var nf *repository.ScheduleNotFoundError
+			if !errors.Is(err, repository.ErrNotFound) || !errors.As(err, &nf) || !nf.Date.Equal(day(tt.date)) {
+				t.Errorf("FindByDate(%s) error = %v, want ScheduleNotFoundError for the date", tt.date, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("FindByDate(%s) error = %v", tt.date, err)
+			continue
+		}
+		if cs.ID != tt.want {
+			t.Errorf("FindByDate(%s) = %s, want %s", tt.date, cs.ID, tt.want)
+		}
+
+		// 重なりのない日付では線形探索の結果と一致する
+		if linear, err := base.FindByDate(context.Background(), day(tt.date)); err != nil || linear.ID != cs.ID {
+			t.Errorf("FindByDate(%s) = %s, linear search = %v (%v)", tt.date, cs.ID, linear, err)
+		}
+	}
+}
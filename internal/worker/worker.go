@@ -0,0 +1,273 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/failure"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/importrun"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/logging"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/metrics"
+)
+
+const (
+	// 個別にログを出すエラーの上限
+	// 超えた分は件数だけ数える
+	errorMaxNum = 50
+
+	maxRetries      = 5
+	initialInterval = 500 * time.Millisecond
+)
+
+// ハンドラーが返すと、メッセージを削除せずに可視性タイムアウト後の再配信に任せる
+// 失敗としては数えない
+var ErrRedeliver = errors.New("left for redelivery")
+
+// メッセージの配信試行回数と dead letter を記録する
+// deadletter.Tracker が実装する
+type Tracker interface {
+	Fail(ctx context.Context, mqc simplemq.SimpleMQ, msg *simplemq.Message, cause error) error
+	Discard(ctx context.Context, mqc simplemq.SimpleMQ, msg *simplemq.Message, cause error) error
+	Clear(ctx context.Context, msgID string) error
+}
+
+// ハンドラーの失敗
+type Error struct {
+	// metrics.Category* のいずれか
+	Category string
+	Message  string
+	Err      error
+	// import_runs に記録するイベントID (ない場合は 0)
+	EventID uint
+	// ログに付ける属性 (slog のキーと値の組)
+	Attrs []any
+	// 何度受信しても処理できないメッセージは、試行回数を待たずに dead letter に移す
+	Discard bool
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// キューから受け取ったメッセージを処理する
+// nil を返すとメッセージを削除し、ErrRedeliver を返すとそのまま残す
+// 失敗した場合は *Error を返す
+type Handler func(ctx context.Context, msg *simplemq.Message) error
+
+// キューが空になるかシャットダウンが要求されるまで、メッセージを並行して処理する
+// 処理中のメッセージは可視性タイムアウトを延長し続け、失敗したものは試行回数を記録する
+type Worker struct {
+	mqc     simplemq.SimpleMQ
+	tracker Tracker
+	m       *metrics.Metrics
+	agg     *failure.Aggregator
+	ledger  *importrun.Ledger
+
+	concurrency       int
+	heartbeatInterval time.Duration
+	shutdownTimeout   time.Duration
+}
+
+func NewWorker(
+	mqc simplemq.SimpleMQ,
+	tracker Tracker,
+	m *metrics.Metrics,
+	agg *failure.Aggregator,
+	ledger *importrun.Ledger,
+	concurrency int,
+	heartbeatInterval time.Duration,
+	shutdownTimeout time.Duration,
+) *Worker {
+	return &Worker{
+		mqc:               mqc,
+		tracker:           tracker,
+		m:                 m,
+		agg:               agg,
+		ledger:            ledger,
+		concurrency:       concurrency,
+		heartbeatInterval: heartbeatInterval,
+		shutdownTimeout:   shutdownTimeout,
+	}
+}
+
+// 試行回数や dead letter を記録できないと再配信の上限が効かなくなるので、エラーとして数える
+func (w *Worker) deadLetterError(message string, err error, msgId string) {
+	w.m.Error(metrics.CategoryDeadLetter)
+	w.agg.Add(metrics.CategoryDeadLetter, 1)
+	w.ledger.Error(metrics.CategoryDeadLetter, message, err, 0, msgId)
+	slog.Error(message, logging.KeyMsgID, msgId, logging.KeyCategory, metrics.CategoryDeadLetter, logging.Err(err))
+}
+
+// ctx がキャンセルされたら新しいメッセージの受信をやめ、処理中のメッセージを待ってから戻る
+// 処理中のメッセージはシャットダウンの猶予時間までは続行し、過ぎたら中断する
+// 中断したメッセージは削除しないので、可視性タイムアウト後に再配信される
+func (w *Worker) Run(ctx context.Context, handle Handler) {
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	stopShutdown := context.AfterFunc(ctx, func() {
+		slog.Info("Shutdown requested, waiting for in-flight messages", "shutdown_timeout", w.shutdownTimeout)
+		time.AfterFunc(w.shutdownTimeout, cancelWork)
+	})
+	defer stopShutdown()
+
+	errorChan := make(chan *Error, errorMaxNum)
+
+	// ゴルーチンのエラーを数えてエラーチャンネルに送る
+	// チャンネルがいっぱいの場合は個別のログを諦め、件数だけ数える
+	sendError := func(werr *Error) {
+		w.agg.Add(werr.Category, 1)
+
+		select {
+		case errorChan <- werr:
+		default:
+			w.agg.Drop()
+		}
+	}
+
+	semChan := make(chan struct{}, w.concurrency)
+
+	var wg sync.WaitGroup
+	for {
+		if ctx.Err() != nil {
+			break
+		}
+
+		done := w.m.Time(metrics.StageReceive)
+		res, err := simplemq.ReceiveMessageWithRetry(ctx, w.mqc, maxRetries, initialInterval)
+		done()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			w.m.Error(metrics.CategoryReceive)
+			w.agg.Add(metrics.CategoryReceive, 1)
+			w.ledger.Error(metrics.CategoryReceive, "Failed to receive message from MQ", err, 0, "")
+			slog.Error("Failed to receive message from MQ", logging.KeyStage, metrics.StageReceive, logging.Err(err))
+			continue
+		}
+
+		if len(res.Messages) == 0 {
+			break
+		}
+
+		msg := res.Messages[0]
+		w.m.MessagesReceived.Inc()
+		w.ledger.MessageProcessed()
+
+		// 処理待ちの間も可視性タイムアウトが切れないように、セマフォの取得前から延長を始める
+		stopHeartbeat := simplemq.StartHeartbeat(workCtx, w.mqc, msg.ID, w.heartbeatInterval)
+
+		select {
+		case semChan <- struct{}{}:
+		case <-ctx.Done():
+			// 未着手のメッセージは削除せずに再配信に任せる
+			stopHeartbeat()
+			continue
+		}
+		wg.Add(1)
+		go func(msg *simplemq.Message) {
+			defer func() {
+				stopHeartbeat()
+				wg.Done()
+				<-semChan
+			}()
+
+			logger := slog.With(logging.KeyMsgID, msg.ID)
+
+			// 失敗を報告し、配信試行回数を記録する
+			fail := func(werr *Error) {
+				// シャットダウンによる中断は失敗として数えない
+				if workCtx.Err() != nil {
+					logger.Info("Message interrupted by shutdown, left for redelivery", append(werr.Attrs, logging.KeyStage, werr.Category, logging.Err(werr.Err))...)
+					return
+				}
+
+				w.m.Error(werr.Category)
+				w.ledger.Error(werr.Category, werr.Message, werr.Err, werr.EventID, msg.ID)
+				werr.Attrs = append([]any{logging.KeyMsgID, msg.ID, logging.KeyStage, werr.Category}, werr.Attrs...)
+
+				sendError(werr)
+
+				stopHeartbeat()
+				record := w.tracker.Fail
+				if werr.Discard {
+					record = w.tracker.Discard
+				}
+				if err := record(workCtx, w.mqc, msg, fmt.Errorf("%s: %w", werr.Message, werr.Err)); err != nil {
+					w.deadLetterError("Failed to record failure of message", err, msg.ID)
+				}
+			}
+
+			// 処理を終えたメッセージをキューから削除する
+			complete := func() {
+				stopHeartbeat()
+				if err := w.mqc.DeleteMessage(workCtx, msg.ID); err != nil {
+					w.m.Error(metrics.CategoryDelete)
+					w.ledger.Error(metrics.CategoryDelete, "Failed to delete message from MQ", err, 0, msg.ID)
+					sendError(&Error{
+						Category: metrics.CategoryDelete,
+						Message:  "Failed to delete message from MQ",
+						Err:      err,
+						Attrs:    []any{logging.KeyMsgID, msg.ID},
+					})
+					return
+				}
+
+				if err := w.tracker.Clear(workCtx, msg.ID); err != nil {
+					w.deadLetterError("Failed to clear delivery attempts of message", err, msg.ID)
+				}
+			}
+
+			// ゴルーチン内でのpanic保護
+			defer func() {
+				if r := recover(); r != nil {
+					fail(&Error{
+						Category: metrics.CategoryPanic,
+						Message:  "Unexpected panic occurred in worker goroutine",
+						Err:      fmt.Errorf("panic recovered: %v", r),
+					})
+				}
+			}()
+
+			err := handle(workCtx, msg)
+			if err == nil {
+				complete()
+				return
+			}
+
+			if errors.Is(err, ErrRedeliver) {
+				return
+			}
+
+			var werr *Error
+			if !errors.As(err, &werr) {
+				// *Error 以外を返すのはハンドラーの誤りなので、panic と同じく扱う
+				werr = &Error{
+					Category: metrics.CategoryPanic,
+					Message:  "Unexpected error returned from handler",
+					Err:      err,
+				}
+			}
+			fail(werr)
+		}(msg)
+	}
+
+	// エラー集約
+	go func() {
+		wg.Wait()
+		close(errorChan)
+	}()
+
+	for werr := range errorChan {
+		slog.Error(werr.Message, append(werr.Attrs, logging.KeyCategory, werr.Category, logging.Err(werr.Err))...)
+	}
+}
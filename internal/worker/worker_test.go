@@ -0,0 +1,272 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vsrecorder/import-cityleague-result-job/internal/failure"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/importrun"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/memory"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/infrastructure/simplemq"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/metrics"
+	"github.com/vsrecorder/import-cityleague-result-job/internal/repository"
+)
+
+// Tracker の呼び出しをメッセージの内容ごとに記録する
+type fakeTracker struct {
+	mu        sync.Mutex
+	failed    []string
+	discarded []string
+	cleared   []string
+	// Clear に失敗させる
+	clearErr error
+}
+
+func (t *fakeTracker) Fail(ctx context.Context, mqc simplemq.SimpleMQ, msg *simplemq.Message, cause error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failed = append(t.failed, msg.Content)
+	return nil
+}
+
+func (t *fakeTracker) Discard(ctx context.Context, mqc simplemq.SimpleMQ, msg *simplemq.Message, cause error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.discarded = append(t.discarded, msg.Content)
+	return mqc.DeleteMessage(ctx, msg.ID)
+}
+
+func (t *fakeTracker) Clear(ctx context.Context, msgID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.clearErr != nil {
+		return t.clearErr
+	}
+	t.cleared = append(t.cleared, msgID)
+	return nil
+}
+
+type fixture struct {
+	mqc     simplemq.SimpleMQ
+	tracker *fakeTracker
+	m       *metrics.Metrics
+	agg     *failure.Aggregator
+	runs    repository.ImportRunRepository
+	ledger  *importrun.Ledger
+	worker  *Worker
+}
+
+func newFixture(t *testing.T, contents ...string) *fixture {
+	t.Helper()
+
+	ctx := context.Background()
+	f := &fixture{
+		mqc:     simplemq.NewMemoryMQ(simplemq.DefaultVisibilityTimeout, simplemq.DefaultRetentionPeriod),
+		tracker: &fakeTracker{},
+		m:       metrics.New("test"),
+		agg:     failure.NewAggregator(0),
+		runs:    memory.NewImportRunRepository(),
+	}
+
+	for _, content := range contents {
+		if _, err := f.mqc.SendMessage(ctx, &simplemq.SendMessageRequest{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ledger, err := importrun.Start(ctx, f.runs, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.ledger = ledger
+	f.worker = NewWorker(f.mqc, f.tracker, f.m, f.agg, f.ledger, 4, time.Second, time.Second)
+
+	return f
+}
+
+// 実行を終えて import_runs に記録したエラーを返す
+func (f *fixture) errors(t *testing.T) []importrun.ErrorRecord {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := f.ledger.Finish(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := f.runs.FindById(ctx, f.ledger.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := importrun.Errors(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return records
+}
+
+// キューに残っているメッセージの内容を返す
+// 可視性タイムアウト中のメッセージは含まない
+func (f *fixture) remaining(t *testing.T) []string {
+	t.Helper()
+
+	contents := []string{}
+	for {
+		res, err := f.mqc.ReceiveMessage(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Messages) == 0 {
+			return contents
+		}
+		contents = append(contents, res.Messages[0].Content)
+	}
+}
+
+func TestWorkerRun(t *testing.T) {
+	f := newFixture(t, "ok", "fail", "redeliver", "discard", "panic", "other")
+
+	var mu sync.Mutex
+	handled := map[string]int{}
+
+	f.worker.Run(context.Background(), func(ctx context.Context, msg *simplemq.Message) error {
+		mu.Lock()
+		handled[msg.Content]++
+		mu.Unlock()
+
+		switch msg.Content {
+		case "fail":
+			return &Error{Category: metrics.CategoryImport, Message: "Failed to import", Err: errors.New("boom"), EventID: 512345}
+		case "redeliver":
+			return ErrRedeliver
+		case "discard":
+			return &Error{Category: metrics.CategoryDecode, Message: "Invalid message", Err: errors.New("invalid JSON"), Discard: true}
+		case "panic":
+			panic("unexpected")
+		case "other":
+			return errors.New("not a worker error")
+		}
+		return nil
+	})
+
+	for _, content := range []string{"ok", "fail", "redeliver", "discard", "panic", "other"} {
+		if handled[content] != 1 {
+			t.Errorf("%s handled %d times, want 1", content, handled[content])
+		}
+	}
+
+	if len(f.tracker.cleared) != 1 {
+		t.Errorf("cleared = %v, want 1 message", f.tracker.cleared)
+	}
+	if len(f.tracker.discarded) != 1 || f.tracker.discarded[0] != "discard" {
+		t.Errorf("discarded = %v, want [discard]", f.tracker.discarded)
+	}
+	failed := map[string]bool{}
+	for _, content := range f.tracker.failed {
+		failed[content] = true
+	}
+	if len(f.tracker.failed) != 3 || !failed["fail"] || !failed["panic"] || !failed["other"] {
+		t.Errorf("failed = %v, want fail, panic and other", f.tracker.failed)
+	}
+
+	// 削除したのは ok と discard だけで、残りは可視性タイムアウト後に再配信される
+	if remaining := f.remaining(t); len(remaining) != 0 {
+		t.Errorf("visible messages = %v, want none before the visibility timeout", remaining)
+	}
+
+	if got := f.agg.Total(); got != 4 {
+		t.Errorf("errors = %d, want 4", got)
+	}
+	if f.agg.ExitCode() == 0 {
+		t.Error("ExitCode = 0, want non-zero")
+	}
+
+	categories := map[string]int{}
+	var eventId uint
+	for _, r := range f.errors(t) {
+		categories[r.Category]++
+		if r.Category == metrics.CategoryImport {
+			eventId = r.EventId
+		}
+		if r.MsgId == "" {
+			t.Errorf("error record %+v has no message ID", r)
+		}
+	}
+	want := map[string]int{
+		metrics.CategoryImport: 1,
+		metrics.CategoryDecode: 1,
+		metrics.CategoryPanic:  2,
+	}
+	for category, n := range want {
+		if categories[category] != n {
+			t.Errorf("%s errors = %d, want %d", category, categories[category], n)
+		}
+	}
+	if eventId != 512345 {
+		t.Errorf("event ID of the import error = %d, want 512345", eventId)
+	}
+}
+
+func TestWorkerRunClearError(t *testing.T) {
+	f := newFixture(t, "ok")
+	f.tracker.clearErr = errors.New("database is down")
+
+	f.worker.Run(context.Background(), func(ctx context.Context, msg *simplemq.Message) error {
+		return nil
+	})
+
+	// 試行回数を消せなくてもメッセージは削除する
+	if remaining := f.remaining(t); len(remaining) != 0 {
+		t.Errorf("visible messages = %v, want none", remaining)
+	}
+
+	records := f.errors(t)
+	if len(records) != 1 || records[0].Category != metrics.CategoryDeadLetter {
+		t.Errorf("errors = %+v, want one dead letter error", records)
+	}
+}
+
+func TestWorkerRunShutdown(t *testing.T) {
+	f := newFixture(t, "a", "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// シャットダウン後は新しいメッセージを受信しない
+	f.worker.Run(ctx, func(ctx context.Context, msg *simplemq.Message) error {
+		t.Errorf("handled %s after shutdown", msg.Content)
+		return nil
+	})
+
+	if remaining := f.remaining(t); len(remaining) != 2 {
+		t.Errorf("visible messages = %v, want both", remaining)
+	}
+}
+
+func TestWorkerRunShutdownInterrupts(t *testing.T) {
+	f := newFixture(t, "slow")
+	f.worker.shutdownTimeout = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f.worker.Run(ctx, func(workCtx context.Context, msg *simplemq.Message) error {
+		// 処理中にシャットダウンが要求され、猶予時間を過ぎて中断される
+		cancel()
+		<-workCtx.Done()
+		return &Error{Category: metrics.CategoryImport, Message: "Failed to import", Err: workCtx.Err()}
+	})
+
+	// 中断は失敗として数えない
+	if len(f.tracker.failed) != 0 || len(f.tracker.cleared) != 0 {
+		t.Errorf("failed = %v, cleared = %v, want neither", f.tracker.failed, f.tracker.cleared)
+	}
+	if got := f.agg.Total(); got != 0 {
+		t.Errorf("errors = %d, want 0", got)
+	}
+}